@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"pragprog.com/rggo/interacting/todo"
 )
@@ -23,6 +24,9 @@ func main() {
 	complete := flag.Int("complete", 0, "Mark a task as completed by task number")
 	del := flag.Int("delete", 0, "Delete a task by task number")
 	get := flag.Int("get", 0, "Get a particular task by task number")
+	search := flag.String("search", "", "Search tasks by words or word starts, best matches first")
+	stats := flag.Bool("stats", false, "Show completion statistics of the list")
+	asJSON := flag.Bool("json", false, "Print -stats as JSON")
 	flag.Parse()
 
 	todolist := todo.NewList()
@@ -73,12 +77,42 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Println(string(bytes))
+	case *stats:
+		s := todolist.Stats(time.Now())
+		if !*asJSON {
+			fmt.Print(s)
+			return
+		}
+		bytes, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: Could not marshal the statistics", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(bytes))
+	case *search != "":
+		printMatches(os.Stdout, todolist, todolist.Search(*search))
 	default:
 		fmt.Fprintln(os.Stderr, "Indalid option see todo -h tor help")
 		os.Exit(1)
 	}
 }
 
+// printMatches lists search matches like -list does, with the matched
+// words in bold on a terminal and between brackets otherwise.
+func printMatches(out *os.File, list *todo.List, matches []todo.Match) {
+	open, close := "[", "]"
+	if fi, err := out.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		open, close = "\x1b[1m", "\x1b[0m"
+	}
+	for _, m := range matches {
+		prefix := "  "
+		if item, _ := list.Get(m.ID); item.Done {
+			prefix = "X "
+		}
+		fmt.Fprintf(out, "%s%d: %s\n", prefix, m.ID, m.Highlight(open, close))
+	}
+}
+
 func GetTask(r io.Reader, args ...string) (string, error) {
 	if len(args) > 0 {
 		return strings.Join(args, " "), nil
@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -67,4 +68,33 @@ func TestTodoCli(t *testing.T) {
 			t.Fatalf("Failed to run command: %s", err)
 		}
 	})
+
+	t.Run("Stats Check", func(t *testing.T) {
+		cmd := exec.Command(cmdPath, "-stats", "-json")
+		result, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Failed to run command: %s", err)
+		}
+		var stats struct {
+			Total int `json:"total"`
+			Done  int `json:"done"`
+		}
+		if err := json.Unmarshal(result, &stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Total != 1 || stats.Done != 1 {
+			t.Fatalf("Expected 1 done item of 1, got %s", result)
+		}
+	})
+
+	t.Run("Search Task Check", func(t *testing.T) {
+		cmd := exec.Command(cmdPath, "-search", "NUM")
+		result, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Failed to run command: %s", err)
+		}
+		if exp := "X 1: Task [number] one\n"; string(result) != exp {
+			t.Fatalf("Expected %q, got %q", exp, string(result))
+		}
+	})
 }
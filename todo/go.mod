@@ -1,3 +1,5 @@
 module pragprog.com/rggo/interacting/todo
 
 go 1.25.4
+
+require golang.org/x/text v0.28.0
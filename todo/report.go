@@ -0,0 +1,80 @@
+package todo
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// ReportItem is an item of a Report. Age is how long it was open: until
+// it was completed, or until the end of the report for open items.
+type ReportItem struct {
+	ID          int
+	Task        string
+	Done        bool
+	CreatedAt   time.Time
+	CompletedAt time.Time
+	Age         Duration
+}
+
+// Report summarizes what happened to the list between Since and Until.
+// Items have no due date, so Overdue are the items still open that were
+// added before the period started. Oldest are the StatsOldest items open
+// the longest.
+type Report struct {
+	Since     time.Time
+	Until     time.Time
+	Completed []ReportItem
+	Added     []ReportItem
+	Overdue   []ReportItem
+	Oldest    []ReportItem
+}
+
+// Report returns the report of the list for the period from since to
+// now. Completed and Added are in the order it happened, Overdue and
+// Oldest are the oldest first.
+func (l *List) Report(since, now time.Time) Report {
+	r := Report{Since: since, Until: now}
+	var open []ReportItem
+	for k, it := range *l {
+		ri := ReportItem{ID: k + 1, Task: it.Task, Done: it.Done, CreatedAt: it.CreatedAt, CompletedAt: it.CompletedAt}
+		if it.Done {
+			if !it.CompletedAt.IsZero() && !it.CompletedAt.Before(it.CreatedAt) {
+				ri.Age = Duration(it.CompletedAt.Sub(it.CreatedAt))
+			}
+		} else {
+			ri.Age = Duration(now.Sub(it.CreatedAt))
+		}
+		if inPeriod(it.CreatedAt, since, now) {
+			r.Added = append(r.Added, ri)
+		}
+		if it.Done && inPeriod(it.CompletedAt, since, now) {
+			r.Completed = append(r.Completed, ri)
+		}
+		if it.Done {
+			continue
+		}
+		open = append(open, ri)
+		if it.CreatedAt.Before(since) {
+			r.Overdue = append(r.Overdue, ri)
+		}
+	}
+
+	slices.SortStableFunc(r.Completed, func(a, b ReportItem) int {
+		return a.CompletedAt.Compare(b.CompletedAt)
+	})
+	slices.SortStableFunc(r.Added, func(a, b ReportItem) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	byAge := func(a, b ReportItem) int {
+		return cmp.Compare(b.Age, a.Age)
+	}
+	slices.SortStableFunc(r.Overdue, byAge)
+	slices.SortStableFunc(open, byAge)
+	r.Oldest = open[:min(len(open), StatsOldest)]
+	return r
+}
+
+func inPeriod(t, since, until time.Time) bool {
+	return !t.Before(since) && !t.After(until)
+}
@@ -0,0 +1,271 @@
+package todo
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Range is a byte range of a task.
+type Range struct {
+	Start, End int
+}
+
+// Match is an item found by a search. ID is its number in the list and
+// Ranges are the words of the task that matched, in order.
+type Match struct {
+	ID     int
+	Task   string
+	Score  float64
+	Ranges []Range
+}
+
+// Highlight returns the task with the matched words between open and
+// close.
+func (m Match) Highlight(open, close string) string {
+	var b strings.Builder
+	last := 0
+	for _, r := range m.Ranges {
+		b.WriteString(m.Task[last:r.Start])
+		b.WriteString(open)
+		b.WriteString(m.Task[r.Start:r.End])
+		b.WriteString(close)
+		last = r.End
+	}
+	b.WriteString(m.Task[last:])
+	return b.String()
+}
+
+// Letters that do not decompose into a base letter and a mark.
+var foldLetters = strings.NewReplacer("ß", "ss", "æ", "ae", "œ", "oe", "ø", "o", "ł", "l", "đ", "d", "ı", "i")
+
+// fold lowercases s and strips its diacritics, so "Café" matches "cafe".
+func fold(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, strings.ToLower(s))
+	if err != nil {
+		folded = strings.ToLower(s)
+	}
+	return foldLetters.Replace(folded)
+}
+
+// token is a folded word of a task and where the word is in it.
+type token struct {
+	term string
+	Range
+}
+
+// tokenize splits s into words of letters and digits.
+func tokenize(s string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range s {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			tokens = append(tokens, token{fold(s[start:i]), Range{start, i}})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{fold(s[start:]), Range{start, len(s)}})
+	}
+	return tokens
+}
+
+type document struct {
+	task   string
+	tokens []token
+}
+
+// Index is an inverted index of the tasks of a list. Its methods follow
+// the changes made to the list, so the index does not need rebuilding.
+// It is not safe for concurrent use.
+type Index struct {
+	docs []*document
+	// postings maps each term to the documents holding it and how many
+	// times they do. terms keeps its keys sorted for prefix lookups.
+	postings map[string]map[*document]int
+	terms    []string
+}
+
+// NewIndex indexes the tasks of l.
+func NewIndex(l List) *Index {
+	x := &Index{postings: map[string]map[*document]int{}}
+	for _, it := range l {
+		x.Add(it.Task)
+	}
+	return x
+}
+
+// Len returns the number of items indexed.
+func (x *Index) Len() int {
+	return len(x.docs)
+}
+
+// Add indexes a task added at the end of the list.
+func (x *Index) Add(task string) {
+	x.Insert(len(x.docs)+1, task)
+}
+
+// Insert indexes a task put at position i, shifting the ones after it.
+func (x *Index) Insert(i int, task string) error {
+	if i <= 0 || i > len(x.docs)+1 {
+		return fmt.Errorf("position %d does not exist", i)
+	}
+	d := &document{task: task, tokens: tokenize(task)}
+	x.docs = slices.Insert(x.docs, i-1, d)
+	x.link(d)
+	return nil
+}
+
+// Edit reindexes item i with a new task.
+func (x *Index) Edit(i int, task string) error {
+	if i <= 0 || i > len(x.docs) {
+		return fmt.Errorf("item %d does not exist", i)
+	}
+	d := x.docs[i-1]
+	x.unlink(d)
+	d.task, d.tokens = task, tokenize(task)
+	x.link(d)
+	return nil
+}
+
+// Delete drops item i from the index.
+func (x *Index) Delete(i int) error {
+	if i <= 0 || i > len(x.docs) {
+		return fmt.Errorf("item %d does not exist", i)
+	}
+	x.unlink(x.docs[i-1])
+	x.docs = slices.Delete(x.docs, i-1, i)
+	return nil
+}
+
+// Move follows List.Move.
+func (x *Index) Move(from, to int) error {
+	if from <= 0 || from > len(x.docs) {
+		return fmt.Errorf("item %d does not exist", from)
+	}
+	if to <= 0 || to > len(x.docs) {
+		return fmt.Errorf("position %d does not exist", to)
+	}
+	d := x.docs[from-1]
+	x.docs = slices.Insert(slices.Delete(x.docs, from-1, from), to-1, d)
+	return nil
+}
+
+func (x *Index) link(d *document) {
+	for _, t := range d.tokens {
+		docs, ok := x.postings[t.term]
+		if !ok {
+			docs = map[*document]int{}
+			x.postings[t.term] = docs
+			i, _ := slices.BinarySearch(x.terms, t.term)
+			x.terms = slices.Insert(x.terms, i, t.term)
+		}
+		docs[d]++
+	}
+}
+
+func (x *Index) unlink(d *document) {
+	for _, t := range d.tokens {
+		docs := x.postings[t.term]
+		if docs == nil {
+			continue
+		}
+		delete(docs, d)
+		if len(docs) == 0 {
+			delete(x.postings, t.term)
+			if i, ok := slices.BinarySearch(x.terms, t.term); ok {
+				x.terms = slices.Delete(x.terms, i, i+1)
+			}
+		}
+	}
+}
+
+// prefixed returns the terms starting with prefix.
+func (x *Index) prefixed(prefix string) []string {
+	i := sort.SearchStrings(x.terms, prefix)
+	j := i
+	for j < len(x.terms) && strings.HasPrefix(x.terms[j], prefix) {
+		j++
+	}
+	return x.terms[i:j]
+}
+
+// Search finds the items holding every word of query, as a word or the
+// start of one, ignoring case and diacritics. Matches come best first:
+// whole words count more than prefixes, rare words more than common ones
+// and short tasks more than long ones. Equal matches keep list order.
+func (x *Index) Search(query string) []Match {
+	var words []string
+	for _, t := range tokenize(query) {
+		if !slices.Contains(words, t.term) {
+			words = append(words, t.term)
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	var scores map[*document]float64
+	for _, w := range words {
+		best := map[*document]float64{}
+		for _, term := range x.prefixed(w) {
+			weight := 0.5
+			if term == w {
+				weight = 1
+			}
+			idf := math.Log(1 + float64(len(x.docs))/float64(len(x.postings[term])))
+			for d, tf := range x.postings[term] {
+				best[d] = max(best[d], weight*idf*(1+math.Log(float64(tf))))
+			}
+		}
+		if scores == nil {
+			scores = best
+			continue
+		}
+		// Every word must match.
+		for d, s := range scores {
+			if b, ok := best[d]; ok {
+				scores[d] = s + b
+			} else {
+				delete(scores, d)
+			}
+		}
+	}
+
+	var matches []Match
+	for i, d := range x.docs {
+		s, ok := scores[d]
+		if !ok {
+			continue
+		}
+		m := Match{ID: i + 1, Task: d.task, Score: s / math.Sqrt(float64(len(d.tokens)))}
+		for _, t := range d.tokens {
+			if slices.ContainsFunc(words, func(w string) bool { return strings.HasPrefix(t.term, w) }) {
+				m.Ranges = append(m.Ranges, t.Range)
+			}
+		}
+		matches = append(matches, m)
+	}
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return matches
+}
+
+// Search finds the items of l matching query, see Index.Search.
+func (l *List) Search(query string) []Match {
+	return NewIndex(*l).Search(query)
+}
@@ -0,0 +1,250 @@
+package todo
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Periods and items covered by Stats.
+const (
+	StatsDays   = 14
+	StatsWeeks  = 8
+	StatsOldest = 5
+)
+
+// Duration is a time.Duration that is encoded as seconds in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).Seconds())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s float64
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*d = Duration(s * float64(time.Second))
+	return nil
+}
+
+// String rounds d to what matters for tasks, e.g. "3d4h", "2h" or "25m".
+func (d Duration) String() string {
+	t := time.Duration(d)
+	switch {
+	case t >= 24*time.Hour:
+		days, hours := t/(24*time.Hour), (t%(24*time.Hour))/time.Hour
+		if hours == 0 {
+			return fmt.Sprintf("%dd", days)
+		}
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case t >= time.Minute:
+		s := strings.TrimSuffix(t.Round(time.Minute).String(), "0s")
+		if strings.HasSuffix(s, "h0m") {
+			s = strings.TrimSuffix(s, "0m")
+		}
+		return s
+	}
+	return t.Round(time.Second).String()
+}
+
+// Period counts the items completed in the day or week starting at Start.
+type Period struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// AgeBucket counts the open items created between Min and Max ago, Max
+// being zero for the oldest bucket.
+type AgeBucket struct {
+	Label string   `json:"label"`
+	Min   Duration `json:"min_seconds"`
+	Max   Duration `json:"max_seconds,omitempty"`
+	Count int      `json:"count"`
+}
+
+// OpenItem is an item not done yet and how long ago it was created.
+type OpenItem struct {
+	ID   int      `json:"id"`
+	Task string   `json:"task"`
+	Age  Duration `json:"age_seconds"`
+}
+
+// Stats is the throughput of a list. Lead times run from the creation
+// of an item to its completion.
+type Stats struct {
+	Time           time.Time   `json:"time"`
+	Total          int         `json:"total"`
+	Open           int         `json:"open"`
+	Done           int         `json:"done"`
+	CompletionRate float64     `json:"completion_rate"`
+	MedianLeadTime Duration    `json:"median_lead_time_seconds"`
+	P90LeadTime    Duration    `json:"p90_lead_time_seconds"`
+	PerDay         []Period    `json:"completed_per_day"`
+	PerWeek        []Period    `json:"completed_per_week"`
+	Aging          []AgeBucket `json:"aging"`
+	Oldest         []OpenItem  `json:"oldest_open"`
+}
+
+var ageBuckets = []AgeBucket{
+	{Label: "< 1 day", Max: Duration(24 * time.Hour)},
+	{Label: "1-7 days", Min: Duration(24 * time.Hour), Max: Duration(7 * 24 * time.Hour)},
+	{Label: "7-30 days", Min: Duration(7 * 24 * time.Hour), Max: Duration(30 * 24 * time.Hour)},
+	{Label: "> 30 days", Min: Duration(30 * 24 * time.Hour)},
+}
+
+// Stats computes the statistics of l at now. Days and weeks, which start
+// on Monday, are those of now's location, the last StatsDays days and
+// StatsWeeks weeks up to now, oldest first.
+func (l *List) Stats(now time.Time) Stats {
+	s := Stats{Time: now, Aging: slices.Clone(ageBuckets), Oldest: []OpenItem{}}
+
+	s.PerDay = l.CompletedPerDay(now, StatsDays)
+	today := startOfDay(now)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	for i := StatsWeeks - 1; i >= 0; i-- {
+		s.PerWeek = append(s.PerWeek, Period{Start: monday.AddDate(0, 0, -7*i)})
+	}
+
+	var leads []time.Duration
+	for k, it := range *l {
+		s.Total++
+		if !it.Done {
+			s.Open++
+			age := Duration(now.Sub(it.CreatedAt))
+			for i := range s.Aging {
+				if b := s.Aging[i]; age >= b.Min && (b.Max == 0 || age < b.Max) {
+					s.Aging[i].Count++
+				}
+			}
+			s.Oldest = append(s.Oldest, OpenItem{ID: k + 1, Task: it.Task, Age: age})
+			continue
+		}
+		s.Done++
+		if it.CompletedAt.IsZero() || it.CompletedAt.Before(it.CreatedAt) {
+			continue
+		}
+		leads = append(leads, it.CompletedAt.Sub(it.CreatedAt))
+		countPeriod(s.PerWeek, it.CompletedAt, 7)
+	}
+	if s.Total > 0 {
+		s.CompletionRate = float64(s.Done) / float64(s.Total)
+	}
+	slices.Sort(leads)
+	s.MedianLeadTime = Duration(percentile(leads, 0.5))
+	s.P90LeadTime = Duration(percentile(leads, 0.9))
+
+	slices.SortStableFunc(s.Oldest, func(a, b OpenItem) int {
+		return cmp.Compare(b.Age, a.Age)
+	})
+	if len(s.Oldest) > StatsOldest {
+		s.Oldest = s.Oldest[:StatsOldest]
+	}
+	return s
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// lastDays returns periods for the days days up to now, oldest first.
+func lastDays(now time.Time, days int) []Period {
+	today := startOfDay(now)
+	periods := make([]Period, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		periods = append(periods, Period{Start: today.AddDate(0, 0, -i)})
+	}
+	return periods
+}
+
+// CompletedPerDay counts the items completed on each of the days days up
+// to now, oldest first.
+func (l *List) CompletedPerDay(now time.Time, days int) []Period {
+	periods := lastDays(now, days)
+	for _, it := range *l {
+		if it.Done && !it.CompletedAt.IsZero() {
+			countPeriod(periods, it.CompletedAt, 1)
+		}
+	}
+	return periods
+}
+
+// OpenPerDay counts the items open at the end of each of the days days
+// up to now, oldest first, today's count being the one at now. Items done
+// without a completion time are left out.
+func (l *List) OpenPerDay(now time.Time, days int) []Period {
+	periods := lastDays(now, days)
+	for i := range periods {
+		end := periods[i].Start.AddDate(0, 0, 1)
+		if end.After(now) {
+			end = now
+		}
+		for _, it := range *l {
+			if it.Done && it.CompletedAt.IsZero() {
+				continue
+			}
+			if it.CreatedAt.Before(end) && (!it.Done || !it.CompletedAt.Before(end)) {
+				periods[i].Count++
+			}
+		}
+	}
+	return periods
+}
+
+// countPeriod counts t in the period of days days it falls in, if any.
+func countPeriod(periods []Period, t time.Time, days int) {
+	for i, p := range periods {
+		if !t.Before(p.Start) && t.Before(p.Start.AddDate(0, 0, days)) {
+			periods[i].Count++
+			return
+		}
+	}
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations,
+// zero when there are none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// String formats the statistics as a text report.
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Items:            %d (%d open, %d done)\n", s.Total, s.Open, s.Done)
+	fmt.Fprintf(&b, "Completion rate:  %.1f%%\n", s.CompletionRate*100)
+	if s.MedianLeadTime == 0 && s.P90LeadTime == 0 {
+		fmt.Fprintf(&b, "Lead time:        n/a\n")
+	} else {
+		fmt.Fprintf(&b, "Lead time:        median %s, p90 %s\n", s.MedianLeadTime, s.P90LeadTime)
+	}
+
+	fmt.Fprintf(&b, "\nCompleted per day:\n")
+	for _, p := range s.PerDay {
+		fmt.Fprintf(&b, "  %s  %3d %s\n", p.Start.Format("Mon Jan 02"), p.Count, strings.Repeat("#", p.Count))
+	}
+	fmt.Fprintf(&b, "\nCompleted per week:\n")
+	for _, p := range s.PerWeek {
+		fmt.Fprintf(&b, "  %s  %3d %s\n", p.Start.Format("Mon Jan 02"), p.Count, strings.Repeat("#", p.Count))
+	}
+
+	fmt.Fprintf(&b, "\nOpen items by age:\n")
+	for _, a := range s.Aging {
+		fmt.Fprintf(&b, "  %-10s %3d\n", a.Label, a.Count)
+	}
+	if len(s.Oldest) > 0 {
+		fmt.Fprintf(&b, "\nOldest open items:\n")
+		for _, it := range s.Oldest {
+			fmt.Fprintf(&b, "  %d: %s (%s)\n", it.ID, it.Task, it.Age)
+		}
+	}
+	return b.String()
+}
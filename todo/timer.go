@@ -0,0 +1,225 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrTimerRunning = errors.New("a timer is already running")
+	ErrNoTimer      = errors.New("no timer is running")
+)
+
+// TimeEntry is time spent on an item. Stop and Duration are zero while
+// the timer runs.
+type TimeEntry struct {
+	Start    time.Time
+	Stop     time.Time
+	Duration Duration
+	Note     string
+}
+
+// Running reports whether the timer of e is still running.
+func (e TimeEntry) Running() bool {
+	return e.Stop.IsZero()
+}
+
+// Spent returns the time of e, counting a running timer until now.
+func (e TimeEntry) Spent(now time.Time) Duration {
+	if e.Running() {
+		return Duration(now.Sub(e.Start))
+	}
+	return e.Duration
+}
+
+// TimeSpent returns the total time logged on the item, counting a
+// running timer until now.
+func (it item) TimeSpent(now time.Time) Duration {
+	var total Duration
+	for _, e := range it.TimeEntries {
+		total += e.Spent(now)
+	}
+	return total
+}
+
+// stopTimer stops the running timer of the item, if any. The entries
+// are copied first, so copies of the item taken before keep the timer
+// running.
+func (it *item) stopTimer(now time.Time) {
+	n := len(it.TimeEntries)
+	if n == 0 || !it.TimeEntries[n-1].Running() {
+		return
+	}
+	it.TimeEntries = slices.Clone(it.TimeEntries)
+	e := &it.TimeEntries[n-1]
+	e.Stop = now
+	e.Duration = Duration(now.Sub(e.Start))
+}
+
+// Running returns the number of the item whose timer runs, 0 if none.
+// A list has at most one running timer.
+func (l *List) Running() int {
+	for k, it := range *l {
+		if n := len(it.TimeEntries); n > 0 && it.TimeEntries[n-1].Running() {
+			return k + 1
+		}
+	}
+	return 0
+}
+
+// Start starts a timer on item i with an optional note. It fails when a
+// timer already runs on any item of the list.
+func (l *List) Start(i int, note string) error {
+	list := *l
+	if i <= 0 || i > len(list) {
+		return fmt.Errorf("item %d does not exist", i)
+	}
+	if n := l.Running(); n != 0 {
+		return fmt.Errorf("%w on item %d", ErrTimerRunning, n)
+	}
+	list[i-1].TimeEntries = append(list[i-1].TimeEntries, TimeEntry{Start: time.Now(), Note: note})
+	return nil
+}
+
+// Stop stops the running timer and returns the number of its item.
+func (l *List) Stop() (int, error) {
+	n := l.Running()
+	if n == 0 {
+		return 0, ErrNoTimer
+	}
+	(*l)[n-1].stopTimer(time.Now())
+	return n, nil
+}
+
+// TimesheetRow is the time logged on an item on each day of a Timesheet.
+type TimesheetRow struct {
+	ID    int        `json:"id"`
+	Task  string     `json:"task"`
+	Days  []Duration `json:"days_seconds"`
+	Total Duration   `json:"total_seconds"`
+}
+
+// Timesheet is the time logged on the items of a list day by day,
+// starting at Start. Running timers count until the time it was made.
+type Timesheet struct {
+	Start     time.Time      `json:"start"`
+	Days      []time.Time    `json:"days"`
+	Rows      []TimesheetRow `json:"rows"`
+	DayTotals []Duration     `json:"day_totals_seconds"`
+	Total     Duration       `json:"total_seconds"`
+}
+
+// Timesheet returns the time logged on the items of the list in the days
+// days from the day of start, splitting entries at midnight. Items with
+// no time in those days are left out.
+func (l *List) Timesheet(start time.Time, days int, now time.Time) Timesheet {
+	start = startOfDay(start)
+	ts := Timesheet{Start: start, Rows: []TimesheetRow{}, DayTotals: make([]Duration, days)}
+	for d := range days {
+		ts.Days = append(ts.Days, start.AddDate(0, 0, d))
+	}
+	end := start.AddDate(0, 0, days)
+
+	for k, it := range *l {
+		row := TimesheetRow{ID: k + 1, Task: it.Task, Days: make([]Duration, days)}
+		for _, e := range it.TimeEntries {
+			stop := e.Stop
+			if e.Running() {
+				stop = now
+			}
+			if !stop.After(start) || !e.Start.Before(end) {
+				continue
+			}
+			for d, dayStart := range ts.Days {
+				dayEnd := end
+				if d+1 < days {
+					dayEnd = ts.Days[d+1]
+				}
+				from, to := maxTime(e.Start, dayStart), minTime(stop, dayEnd)
+				if to.After(from) {
+					row.Days[d] += Duration(to.Sub(from))
+				}
+			}
+		}
+		for d, spent := range row.Days {
+			row.Total += spent
+			ts.DayTotals[d] += spent
+		}
+		if row.Total > 0 {
+			ts.Rows = append(ts.Rows, row)
+			ts.Total += row.Total
+		}
+	}
+	return ts
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// String formats the timesheet as a table, one column per day and a row
+// per item, with the totals last.
+func (ts Timesheet) String() string {
+	if len(ts.Days) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	first, last := ts.Days[0], ts.Days[len(ts.Days)-1]
+	if len(ts.Days) == 1 {
+		fmt.Fprintf(&b, "Timesheet %s\n\n", first.Format("Mon Jan 02, 2006"))
+	} else {
+		fmt.Fprintf(&b, "Timesheet %s to %s\n\n", first.Format("Mon Jan 02"), last.Format("Mon Jan 02, 2006"))
+	}
+	if len(ts.Rows) == 0 {
+		b.WriteString("No time logged\n")
+		return b.String()
+	}
+
+	width := len("Total")
+	for _, row := range ts.Rows {
+		width = max(width, utf8.RuneCountInString(fmt.Sprintf("%d: %s", row.ID, row.Task)))
+	}
+	cell := func(d Duration) string {
+		if d == 0 {
+			return "-"
+		}
+		return d.String()
+	}
+	fmt.Fprintf(&b, "  %-*s", width, "")
+	for _, day := range ts.Days {
+		fmt.Fprintf(&b, " %7s", day.Format("Mon 02"))
+	}
+	if len(ts.Days) > 1 {
+		fmt.Fprintf(&b, " %7s", "Total")
+	}
+	b.WriteString("\n")
+	line := func(label string, days []Duration, total Duration) {
+		fmt.Fprintf(&b, "  %-*s", width, label)
+		for _, d := range days {
+			fmt.Fprintf(&b, " %7s", cell(d))
+		}
+		if len(days) > 1 {
+			fmt.Fprintf(&b, " %7s", cell(total))
+		}
+		b.WriteString("\n")
+	}
+	for _, row := range ts.Rows {
+		line(fmt.Sprintf("%d: %s", row.ID, row.Task), row.Days, row.Total)
+	}
+	line("Total", ts.DayTotals, ts.Total)
+	return b.String()
+}
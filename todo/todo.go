@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -13,6 +14,7 @@ type item struct {
 	Done        bool
 	CreatedAt   time.Time
 	CompletedAt time.Time
+	TimeEntries []TimeEntry `json:",omitempty"`
 }
 
 type List []item
@@ -37,8 +39,35 @@ func (l *List) Complete(i int) error {
 	if i <= 0 || i > len(list) {
 		return fmt.Errorf("item %d does not exist", i)
 	}
+	now := time.Now()
 	list[i-1].Done = true
-	list[i-1].CompletedAt = time.Now()
+	list[i-1].CompletedAt = now
+	list[i-1].stopTimer(now)
+	return nil
+}
+
+func (l *List) Edit(i int, task string) error {
+	list := *l
+	if i <= 0 || i > len(list) {
+		return fmt.Errorf("item %d does not exist", i)
+	}
+	list[i-1].Task = task
+	return nil
+}
+
+// Move puts item from at position to, shifting the items in between.
+func (l *List) Move(from, to int) error {
+	list := *l
+	if from <= 0 || from > len(list) {
+		return fmt.Errorf("item %d does not exist", from)
+	}
+	if to <= 0 || to > len(list) {
+		return fmt.Errorf("position %d does not exist", to)
+	}
+	it := list[from-1]
+	list = append(list[:from-1], list[from:]...)
+	list = append(list[:to-1], append([]item{it}, list[to-1:]...)...)
+	*l = list
 	return nil
 }
 
@@ -51,23 +80,58 @@ func (l *List) Delete(i int) error {
 	return nil
 }
 
+// Save writes the list to a temporary file and renames it over filename,
+// so an interrupted save never leaves a truncated list behind.
 func (l *List) Save(filename string) error {
-	js, err := json.Marshal(l)
+	return saveJSON(filename, l)
+}
+
+func (l *List) GetFile(filename string) error {
+	return readJSON(filename, l)
+}
+
+func saveJSON(filename string, v any) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filename, js, 0644)
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(js); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
 }
 
-func (l *List) GetFile(filename string) error {
+// readJSON decodes filename into v, leaving v as it is when the file is
+// missing or empty.
+func readJSON(filename string, v any) error {
 	file, err := os.ReadFile(filename)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) || len(file) == 0 {
+		if errors.Is(err, os.ErrNotExist) {
 			return nil
 		}
 		return err
 	}
-	return json.Unmarshal(file, l)
+	if len(file) == 0 {
+		return nil
+	}
+	return json.Unmarshal(file, v)
 }
 
 func (l *List) Get(i int) (*item, error) {
@@ -1,9 +1,14 @@
 package todo_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"pragprog.com/rggo/interacting/todo"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestAdd(t *testing.T) {
@@ -49,6 +54,50 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestEdit(t *testing.T) {
+	list := todo.List{}
+	list.Add("Task to edit")
+	if err := list.Edit(1, "Edited task"); err != nil {
+		t.Fatal(err)
+	}
+	if list[0].Task != "Edited task" {
+		t.Errorf("Expected task name %q, got %q", "Edited task", list[0].Task)
+	}
+	if err := list.Edit(2, "Missing"); err == nil {
+		t.Errorf("Expected error editing missing item")
+	}
+}
+
+func TestMove(t *testing.T) {
+	testCases := []struct {
+		name     string
+		from, to int
+		exp      string
+	}{
+		{name: "Down", from: 1, to: 3, exp: "BCA"},
+		{name: "Up", from: 3, to: 1, exp: "CAB"},
+		{name: "Same", from: 2, to: 2, exp: "ABC"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			list := todo.List{}
+			for _, task := range []string{"A", "B", "C"} {
+				list.Add(task)
+			}
+			if err := list.Move(tc.from, tc.to); err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			for _, i := range list {
+				got += i.Task
+			}
+			if got != tc.exp {
+				t.Errorf("Expected order %s, got %s", tc.exp, got)
+			}
+		})
+	}
+}
+
 func TestSaveGet(t *testing.T) {
 	list := todo.List{}
 	task := "Task to check Save and Get"
@@ -63,3 +112,345 @@ func TestSaveGet(t *testing.T) {
 		t.Errorf("Failed to remove test file %s", err)
 	}
 }
+
+func TestTrash(t *testing.T) {
+	list := todo.List{}
+	for _, task := range []string{"A", "B", "C"} {
+		list.Add(task)
+	}
+	trash := todo.Trash{}
+	if err := trash.Delete(&list, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || len(trash) != 1 || trash[0].Task != "B" || trash[0].Position != 2 {
+		t.Fatalf("Expected B in the trash, got list %v and trash %v", list, trash)
+	}
+	if err := trash.Delete(&list, 3); err == nil {
+		t.Error("Expected error deleting missing item")
+	}
+
+	pos, err := trash.Restore(1, &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != 2 || len(trash) != 0 || list[1].Task != "B" {
+		t.Errorf("Expected B restored at 2, got %d with list %v", pos, list)
+	}
+
+	// An item restored to a shorter list goes to its end.
+	trash.Delete(&list, 3)
+	list.Delete(1)
+	if pos, _ := trash.Restore(1, &list); pos != 2 || list[1].Task != "C" {
+		t.Errorf("Expected C restored at 2, got %d with list %v", pos, list)
+	}
+	if _, err := trash.Restore(1, &list); err == nil {
+		t.Error("Expected error restoring missing item")
+	}
+
+	trash.Delete(&list, 1)
+	trash.Delete(&list, 1)
+	trash[0].DeletedAt = time.Now().Add(-48 * time.Hour)
+	if n := trash.Purge(time.Now().Add(-24 * time.Hour)); n != 1 || len(trash) != 1 || trash[0].Task != "C" {
+		t.Errorf("Expected 1 item purged leaving C, got %d and %v", n, trash)
+	}
+
+	if err := trash.Save("trash_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("trash_test.json")
+	got := todo.Trash{}
+	if err := got.GetFile("trash_test.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Task != "C" || got[0].Position != 1 {
+		t.Errorf("Expected saved trash to hold C, got %v", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	list := todo.List{}
+	for _, task := range []string{
+		"Send the invoice to ACME",
+		"Café meeting about invoices",
+		"Invoice",
+		"Buy milk",
+	} {
+		list.Add(task)
+	}
+
+	testCases := []struct {
+		name  string
+		query string
+		exp   []string
+	}{
+		{name: "Word first", query: "invoice", exp: []string{"[Invoice]", "Send the [invoice] to ACME", "Café meeting about [invoices]"}},
+		{name: "Prefix", query: "INV", exp: []string{"[Invoice]", "Café meeting about [invoices]", "Send the [invoice] to ACME"}},
+		{name: "Diacritics", query: "cafe", exp: []string{"[Café] meeting about invoices"}},
+		{name: "All words", query: "invoice acme", exp: []string{"Send the [invoice] to [ACME]"}},
+		{name: "No match", query: "bread", exp: nil},
+		{name: "No words", query: " ?! ", exp: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, m := range list.Search(tc.query) {
+				got = append(got, m.Highlight("[", "]"))
+			}
+			if strings.Join(got, "|") != strings.Join(tc.exp, "|") {
+				t.Errorf("Expected %q, got %q", tc.exp, got)
+			}
+		})
+	}
+
+	t.Run("Follows changes", func(t *testing.T) {
+		idx := todo.NewIndex(list)
+		list.Edit(4, "Buy oat milk")
+		idx.Edit(4, "Buy oat milk")
+		list.Move(4, 1)
+		idx.Move(4, 1)
+		list.Delete(2)
+		idx.Delete(2)
+		list.Add("Pay the invoice")
+		idx.Add("Pay the invoice")
+
+		got, exp := idx.Search("oat invoice"), todo.NewIndex(list).Search("oat invoice")
+		if len(got) != 0 || len(exp) != 0 {
+			t.Errorf("Expected no match for both words, got %v and %v", got, exp)
+		}
+		for _, q := range []string{"invoice", "milk", "café"} {
+			got, exp := idx.Search(q), todo.NewIndex(list).Search(q)
+			if len(got) != len(exp) {
+				t.Fatalf("Expected %v for %q, got %v", exp, q, got)
+			}
+			for i := range got {
+				if got[i].ID != exp[i].ID || got[i].Task != exp[i].Task {
+					t.Errorf("Expected %v for %q, got %v", exp, q, got)
+				}
+			}
+		}
+		if m := idx.Search("milk"); len(m) != 1 || m[0].ID != 1 {
+			t.Errorf("Expected the moved item first, got %v", m)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	list := todo.List{}
+	for _, it := range []struct {
+		task               string
+		created, completed time.Duration
+	}{
+		{"A", 10 * day, 8 * day},
+		{"B", 3 * day, day},
+		{"C", 2 * time.Hour, time.Hour},
+		{"D", 40 * day, 0},
+		{"E", 2 * day, 0},
+	} {
+		list.Add(it.task)
+		i := len(list) - 1
+		list[i].CreatedAt = now.Add(-it.created)
+		if it.completed > 0 {
+			list[i].Done = true
+			list[i].CompletedAt = now.Add(-it.completed)
+		}
+	}
+
+	s := list.Stats(now)
+	if s.Total != 5 || s.Open != 2 || s.Done != 3 || s.CompletionRate != 0.6 {
+		t.Errorf("Expected 5 items, 2 open, 3 done and rate 0.6, got %+v", s)
+	}
+	if s.MedianLeadTime != todo.Duration(2*day) || s.P90LeadTime != todo.Duration(2*day) {
+		t.Errorf("Expected lead times of 2 days, got %s and %s", s.MedianLeadTime, s.P90LeadTime)
+	}
+	if len(s.PerDay) != todo.StatsDays || s.PerDay[13].Count != 1 || s.PerDay[12].Count != 1 || s.PerDay[5].Count != 1 {
+		t.Errorf("Expected completions on Oct 06, 13 and 14, got %v", s.PerDay)
+	}
+	if len(s.PerWeek) != todo.StatsWeeks || s.PerWeek[7].Count != 2 || s.PerWeek[6].Count != 1 ||
+		s.PerWeek[7].Start.Weekday() != time.Monday {
+		t.Errorf("Expected 2 completions this week and 1 the week before, got %v", s.PerWeek)
+	}
+	var aging []int
+	for _, a := range s.Aging {
+		aging = append(aging, a.Count)
+	}
+	if fmt.Sprint(aging) != "[0 1 0 1]" {
+		t.Errorf("Expected open items aged 1-7 and over 30 days, got %v", aging)
+	}
+	if len(s.Oldest) != 2 || s.Oldest[0].ID != 4 || s.Oldest[1].ID != 5 {
+		t.Errorf("Expected items 4 and 5 oldest first, got %v", s.Oldest)
+	}
+
+	text := s.String()
+	for _, exp := range []string{
+		"Items:            5 (2 open, 3 done)\n",
+		"Completion rate:  60.0%\n",
+		"Lead time:        median 2d, p90 2d\n",
+		"  Wed Oct 14    1 #\n",
+		"  4: D (40d)\n",
+	} {
+		if !strings.Contains(text, exp) {
+			t.Errorf("Expected %q in report:\n%s", exp, text)
+		}
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"median_lead_time_seconds":172800`) {
+		t.Errorf("Expected lead time in seconds, got %s", data)
+	}
+	var decoded todo.Stats
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.P90LeadTime != s.P90LeadTime {
+		t.Errorf("Expected stats to decode, got %v and %v", decoded.P90LeadTime, err)
+	}
+
+	var open []int
+	for _, p := range list.OpenPerDay(now, 5) {
+		open = append(open, p.Count)
+	}
+	if fmt.Sprint(open) != "[1 2 3 2 2]" {
+		t.Errorf("Expected open items [1 2 3 2 2] from Oct 10, got %v", open)
+	}
+
+	if empty := (&todo.List{}).Stats(now); !strings.Contains(empty.String(), "Lead time:        n/a") {
+		t.Errorf("Expected no lead time for an empty list, got:\n%s", empty)
+	}
+}
+
+func TestReport(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	list := todo.List{}
+	for _, it := range []struct {
+		task               string
+		created, completed time.Duration
+	}{
+		{"A", 10 * day, 8 * day},
+		{"B", 3 * day, day},
+		{"C", 2 * time.Hour, time.Hour},
+		{"D", 40 * day, 0},
+		{"E", 2 * day, 0},
+	} {
+		list.Add(it.task)
+		i := len(list) - 1
+		list[i].CreatedAt = now.Add(-it.created)
+		if it.completed > 0 {
+			list[i].Done = true
+			list[i].CompletedAt = now.Add(-it.completed)
+		}
+	}
+
+	ids := func(items []todo.ReportItem) string {
+		var ids []int
+		for _, it := range items {
+			ids = append(ids, it.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	r := list.Report(now.Add(-7*day), now)
+	testCases := []struct {
+		name  string
+		items []todo.ReportItem
+		exp   string
+	}{
+		{"Completed", r.Completed, "[2 3]"},
+		{"Added", r.Added, "[2 5 3]"},
+		{"Overdue", r.Overdue, "[4]"},
+		{"Oldest", r.Oldest, "[4 5]"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ids(tc.items); got != tc.exp {
+				t.Errorf("Expected items %s, got %s", tc.exp, got)
+			}
+		})
+	}
+	if r.Completed[0].Age != todo.Duration(2*day) || r.Oldest[0].Age != todo.Duration(40*day) {
+		t.Errorf("Expected ages 2d and 40d, got %s and %s", r.Completed[0].Age, r.Oldest[0].Age)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	l := todo.List{}
+	l.Add("A")
+	l.Add("B")
+
+	if err := l.Start(1, "draft"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Start(2, ""); !errors.Is(err, todo.ErrTimerRunning) {
+		t.Errorf("Expected %q, got %v", todo.ErrTimerRunning, err)
+	}
+	if n := l.Running(); n != 1 {
+		t.Errorf("Expected timer on item 1, got %d", n)
+	}
+	n, err := l.Stop()
+	if err != nil || n != 1 {
+		t.Fatalf("Expected item 1 stopped, got %d and %v", n, err)
+	}
+	if _, err := l.Stop(); !errors.Is(err, todo.ErrNoTimer) {
+		t.Errorf("Expected %q, got %v", todo.ErrNoTimer, err)
+	}
+	e := l[0].TimeEntries[0]
+	if e.Note != "draft" || e.Running() || e.Duration != todo.Duration(e.Stop.Sub(e.Start)) {
+		t.Errorf("Expected a stopped entry with its note, got %+v", e)
+	}
+
+	if err := l.Start(2, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Complete(2); err != nil {
+		t.Fatal(err)
+	}
+	if l.Running() != 0 || l[1].TimeEntries[0].Stop != l[1].CompletedAt {
+		t.Errorf("Expected completing item 2 to stop its timer, got %+v", l[1].TimeEntries)
+	}
+}
+
+func TestTimesheet(t *testing.T) {
+	monday := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	now := monday.Add(2*24*time.Hour + 12*time.Hour)
+	l := todo.List{}
+	l.Add("A")
+	l.Add("B")
+	l.Add("C")
+	l[0].TimeEntries = []todo.TimeEntry{
+		{Start: monday.Add(-2 * time.Hour), Stop: monday.Add(-time.Hour), Duration: todo.Duration(time.Hour)},
+		{Start: monday.Add(47 * time.Hour), Stop: monday.Add(49 * time.Hour), Duration: todo.Duration(2 * time.Hour)},
+	}
+	l[1].TimeEntries = []todo.TimeEntry{{Start: now.Add(-30 * time.Minute)}}
+
+	if spent := l[0].TimeSpent(now); spent != todo.Duration(3*time.Hour) {
+		t.Errorf("Expected 3h on item 1, got %s", spent)
+	}
+	if spent := l[1].TimeSpent(now); spent != todo.Duration(30*time.Minute) {
+		t.Errorf("Expected 30m running on item 2, got %s", spent)
+	}
+
+	ts := l.Timesheet(now, 1, now)
+	if len(ts.Rows) != 2 || ts.Rows[0].Total != todo.Duration(time.Hour) || ts.Total != todo.Duration(90*time.Minute) {
+		t.Errorf("Expected 1h on item 1 and 30m on item 2 today, got %+v", ts)
+	}
+
+	ts = l.Timesheet(monday, 7, now)
+	var days []string
+	for _, d := range ts.Rows[0].Days[:3] {
+		days = append(days, d.String())
+	}
+	if fmt.Sprint(days) != "[0s 1h 1h]" || ts.Total != todo.Duration(150*time.Minute) {
+		t.Errorf("Expected item 1 split at midnight and 2h30m in total, got %v and %s", days, ts.Total)
+	}
+	text := ts.String()
+	for _, exp := range []string{
+		"Timesheet Mon Oct 12 to Sun Oct 18, 2026\n",
+		"  1: A        -      1h      1h       -       -       -       -      2h\n",
+		"  Total       -      1h   1h30m       -       -       -       -   2h30m\n",
+	} {
+		if !strings.Contains(text, exp) {
+			t.Errorf("Expected %q in timesheet:\n%s", exp, text)
+		}
+	}
+}
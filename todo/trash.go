@@ -0,0 +1,70 @@
+package todo
+
+import (
+	"fmt"
+	"time"
+)
+
+// Trashed is a deleted item. Position is where it was in the list and
+// DeletedAt when it was removed.
+type Trashed struct {
+	item
+	Position  int
+	DeletedAt time.Time
+}
+
+// Trash holds deleted items, oldest first, so they can be restored.
+type Trash []Trashed
+
+func NewTrash() *Trash {
+	return &Trash{}
+}
+
+// Delete moves item i of l to the trash.
+func (t *Trash) Delete(l *List, i int) error {
+	list := *l
+	if i <= 0 || i > len(list) {
+		return fmt.Errorf("item %d does not exist", i)
+	}
+	now := time.Now()
+	list[i-1].stopTimer(now)
+	*t = append(*t, Trashed{item: list[i-1], Position: i, DeletedAt: now})
+	return l.Delete(i)
+}
+
+// Restore puts trashed item i back into l at the position it was deleted
+// from, or at the end when l is shorter now, and returns that position.
+func (t *Trash) Restore(i int, l *List) (int, error) {
+	trash := *t
+	if i <= 0 || i > len(trash) {
+		return 0, fmt.Errorf("trashed item %d does not exist", i)
+	}
+	it := trash[i-1]
+	pos := min(max(it.Position, 1), len(*l)+1)
+	*l = append((*l)[:pos-1], append(List{it.item}, (*l)[pos-1:]...)...)
+	*t = append(trash[:i-1], trash[i:]...)
+	return pos, nil
+}
+
+// Purge drops the items deleted before the given time and returns how
+// many it dropped.
+func (t *Trash) Purge(before time.Time) int {
+	kept := (*t)[:0]
+	for _, it := range *t {
+		if !it.DeletedAt.Before(before) {
+			kept = append(kept, it)
+		}
+	}
+	n := len(*t) - len(kept)
+	*t = kept
+	return n
+}
+
+// Save writes the trash the way List.Save writes a list.
+func (t *Trash) Save(filename string) error {
+	return saveJSON(filename, t)
+}
+
+func (t *Trash) GetFile(filename string) error {
+	return readJSON(filename, t)
+}
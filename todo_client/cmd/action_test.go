@@ -4,11 +4,23 @@ package cmd
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/viper"
 )
 
 func TestListAction(t *testing.T) {
@@ -227,6 +239,14 @@ func TestCompleteAction(t *testing.T) {
 			args:       []string{""},
 			resp:       testServerResponse["badRequest"],
 		},
+		{name: "Complete list",
+			expUrlPath: "/todo/batch",
+			expMethod:  "POST",
+			expErr:     nil,
+			expOut:     "Items No 1, 3 set as completed",
+			args:       []string{"3", "1"},
+			resp:       testServerResponse["batchApplied"],
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -254,6 +274,9 @@ func TestCompleteAction(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Unexpected error %s", err)
 			}
+			if tc.expOut != out.String() {
+				t.Errorf("Expected output %q, got %q", tc.expOut, out.String())
+			}
 		},
 		)
 	}
@@ -288,6 +311,14 @@ func TestRemoveAction(t *testing.T) {
 			args:       []string{""},
 			resp:       testServerResponse["badRequest"],
 		},
+		{name: "Delete range",
+			expUrlPath: "/todo/batch",
+			expMethod:  "POST",
+			expErr:     ErrInvalidResponse,
+			expOut:     "",
+			args:       []string{"1", "8-9"},
+			resp:       testServerResponse["batchFailed"],
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -319,3 +350,626 @@ func TestRemoveAction(t *testing.T) {
 		)
 	}
 }
+
+func TestTLSClient(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(testServerResponse["resultsMany"].Status)
+		fmt.Fprintln(w, testServerResponse["resultsMany"].Body)
+	}))
+	defer ts.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		caCert   string
+		insecure bool
+		expErr   error
+	}{
+		{name: "Unknown CA", expErr: ErrConnection},
+		{name: "CA certificate", caCert: caFile},
+		{name: "Insecure", insecure: true},
+		{name: "Missing CA file", caCert: caFile + ".missing", expErr: ErrTLSConfig},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Set("ca-cert", tc.caCert)
+			viper.Set("insecure", tc.insecure)
+			t.Cleanup(func() {
+				viper.Set("ca-cert", "")
+				viper.Set("insecure", false)
+			})
+			var out bytes.Buffer
+			err := listAction(&out, ts.URL)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Errorf("Expected error: %s, got %v", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestWatchAction(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lastIDs []string
+	url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/todo/events" {
+			t.Errorf("Expected path /todo/events, got %s", r.URL.Path)
+		}
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch len(lastIDs) {
+		case 1:
+			fmt.Fprint(w, "retry: 10\n\n")
+			fmt.Fprint(w, "id: 5\nevent: item.added\ndata: {\"id\":5,\"type\":\"item.added\",\"position\":3,\"item\":{\"Task\":\"Task_3\"},\"time\":\"2019-10-28T08:23:38Z\"}\n\n")
+		case 2:
+			fmt.Fprint(w, ": ping\n\n")
+			fmt.Fprint(w, "id: 6\nevent: item.reordered\ndata: {\"id\":6,\"type\":\"item.reordered\",\"position\":3,\"to\":1,\"item\":{\"Task\":\"Task_3\"},\"time\":\"2019-10-28T08:24:38Z\"}\n\n")
+			fmt.Fprint(w, "event: stream.reset\ndata: {}\n\n")
+		default:
+			cancel()
+			<-r.Context().Done()
+		}
+	})
+	defer cleanUp()
+
+	var out bytes.Buffer
+	if err := watchAction(ctx, &out, url); err != nil {
+		t.Fatalf("Expected no error, got %q", err)
+	}
+
+	expIDs := []string{"", "5", "6"}
+	if fmt.Sprint(lastIDs) != fmt.Sprint(expIDs) {
+		t.Errorf("Expected Last-Event-ID %q, got %q", expIDs, lastIDs)
+	}
+	expOut := "Oct/28 @08:23 added 3: Task_3\n" +
+		"Oct/28 @08:24 moved 3 to 1: Task_3\n" +
+		"Missed changes, run list to reload\n"
+	if expOut != out.String() {
+		t.Errorf("Expected output %q, got %q", expOut, out.String())
+	}
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+		defer cleanUp()
+		err := watchAction(context.Background(), io.Discard, url)
+		if !errors.Is(err, ErrInvalidResponse) {
+			t.Errorf("Expected error %q, got %q", ErrInvalidResponse, err)
+		}
+	})
+}
+
+func TestBatchItemsError(t *testing.T) {
+	url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintln(w, "Idempotency-Key reused with a different request")
+	})
+	defer cleanUp()
+
+	err := batchItems(url, []batchOp{{Op: "delete", ID: 1}})
+	if !errors.Is(err, ErrInvalidResponse) || !strings.Contains(err.Error(), "Idempotency-Key reused") {
+		t.Errorf("Expected the server's message in the error, got %v", err)
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	var all []int
+	for id := 1; id <= maxBatchOps; id++ {
+		all = append(all, id)
+	}
+	testCases := []struct {
+		args   []string
+		expIDs []int
+		expErr error
+	}{
+		{args: []string{"2"}, expIDs: []int{2}},
+		{args: []string{"1", "3", "5-9"}, expIDs: []int{1, 3, 5, 6, 7, 8, 9}},
+		{args: []string{"4,2", "2-3"}, expIDs: []int{2, 3, 4}},
+		{args: []string{"a"}, expErr: ErrNotNumber},
+		{args: []string{"0"}, expErr: ErrNotNumber},
+		{args: []string{"5-3"}, expErr: ErrNotNumber},
+		{args: []string{"5-"}, expErr: ErrNotNumber},
+		{args: []string{"1-1000"}, expIDs: all},
+		{args: []string{"1-99999999999"}, expErr: ErrInvalid},
+		{args: []string{"1-600", "601-1001"}, expErr: ErrInvalid},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.args), func(t *testing.T) {
+			ids, err := parseIDs(tc.args)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Errorf("Expected error %q, got %v", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tc.expIDs) {
+				t.Errorf("Expected %v, got %v", tc.expIDs, ids)
+			}
+		})
+	}
+}
+
+func TestAddRetry(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	testCases := []struct {
+		name     string
+		statuses []int
+		expCalls int
+		expErr   error
+	}{
+		{name: "Retried", statuses: []int{http.StatusServiceUnavailable, http.StatusCreated}, expCalls: 2},
+		{name: "Not retried", statuses: []int{http.StatusBadRequest}, expCalls: 1, expErr: ErrInvalidResponse},
+		{name: "Give up",
+			statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			expCalls: 3, expErr: ErrInvalidResponse},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var keys []string
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				keys = append(keys, r.Header.Get("Idempotency-Key"))
+				w.WriteHeader(tc.statuses[len(keys)-1])
+			})
+			defer cleanUp()
+
+			err := addAction(io.Discard, url, []string{"Task", "1"})
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Errorf("Expected error %q, got %v", tc.expErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if len(keys) != tc.expCalls {
+				t.Fatalf("Expected %d requests, got %d", tc.expCalls, len(keys))
+			}
+			for _, k := range keys {
+				if k == "" || k != keys[0] {
+					t.Errorf("Expected the same Idempotency-Key on every attempt, got %q", keys)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	testCases := []struct {
+		name     string
+		encoding string
+	}{
+		{name: "Gzip", encoding: "gzip"},
+		{name: "Zstd", encoding: "zstd"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Set("cache-dir", t.TempDir())
+			t.Cleanup(func() { viper.Set("cache-dir", "") })
+
+			const etag = `W/"v1-json"`
+			var statuses []int
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if ae := r.Header.Get("Accept-Encoding"); ae != "zstd, gzip" {
+					t.Errorf("Expected Accept-Encoding %q, got %q", "zstd, gzip", ae)
+				}
+				w.Header().Set("ETag", etag)
+				if r.Header.Get("If-None-Match") == etag {
+					statuses = append(statuses, http.StatusNotModified)
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				statuses = append(statuses, http.StatusOK)
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", tc.encoding)
+				var enc io.WriteCloser
+				if tc.encoding == "gzip" {
+					enc = gzip.NewWriter(w)
+				} else {
+					enc, _ = zstd.NewWriter(w)
+				}
+				fmt.Fprintln(enc, testServerResponse["resultsMany"].Body)
+				enc.Close()
+			})
+			defer cleanUp()
+
+			for i := 0; i < 2; i++ {
+				var out bytes.Buffer
+				if err := listAction(&out, url); err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+				if exp := "-   1   Task_1\n-   2   Task_2\n"; out.String() != exp {
+					t.Errorf("Expected out %q, got %q", exp, out.String())
+				}
+			}
+			if exp := []int{http.StatusOK, http.StatusNotModified}; !slices.Equal(statuses, exp) {
+				t.Errorf("Expected responses %v, got %v", exp, statuses)
+			}
+		})
+	}
+}
+
+func TestTrashAction(t *testing.T) {
+	testCases := []struct {
+		name   string
+		expOut string
+		resp   struct {
+			Status int
+			Body   string
+		}
+	}{
+		{name: "Results",
+			expOut: "X   1   Task_1  deleted Oct/29 @10:30 from 2\n",
+			resp:   testServerResponse["trashOne"],
+		},
+		{name: "Empty",
+			expOut: "Trash is empty\n",
+			resp:   testServerResponse["noTrash"],
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/todo/trash" {
+					t.Errorf("Expected path: /todo/trash, got %s", r.URL.Path)
+				}
+				w.WriteHeader(tc.resp.Status)
+				fmt.Fprintln(w, tc.resp.Body)
+			})
+			defer cleanUp()
+			var out bytes.Buffer
+			if err := trashAction(&out, url); err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if tc.expOut != out.String() {
+				t.Errorf("Expected out %q, got %q", tc.expOut, out.String())
+			}
+		})
+	}
+}
+
+func TestRestoreAction(t *testing.T) {
+	var paths []string
+	url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected method: POST, got %s", r.Method)
+		}
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/todo/trash/9/restore" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Location", "/todo/4")
+		w.WriteHeader(http.StatusOK)
+	})
+	defer cleanUp()
+
+	var out bytes.Buffer
+	if err := restoreAction(&out, url, []string{"1-2"}); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"/todo/trash/2/restore", "/todo/trash/1/restore"}
+	if !slices.Equal(paths, exp) {
+		t.Errorf("Expected requests %q, got %q", exp, paths)
+	}
+	expOut := "Item 2 restored as item No 4\nItem 1 restored as item No 4\n"
+	if out.String() != expOut {
+		t.Errorf("Expected out %q, got %q", expOut, out.String())
+	}
+
+	if err := restoreAction(&out, url, []string{"9"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error %s, got %v", ErrNotFound, err)
+	}
+}
+
+func TestSearchAction(t *testing.T) {
+	testCases := []struct {
+		name   string
+		expOut string
+		body   string
+	}{
+		{name: "Results",
+			expOut: "X   2   Pay the [Café] [invoice]\n-   5   [Invoice] ACMÉ\n",
+			body: `{"results": [
+				{"id": 2, "task": "Pay the Café invoice", "done": true, "score": 1.2,
+				 "matches": [{"start": 8, "end": 13}, {"start": 14, "end": 21}]},
+				{"id": 5, "task": "Invoice ACMÉ", "done": false, "score": 0.4,
+				 "matches": [{"start": 0, "end": 7}]}
+				], "total_results": 2}`,
+		},
+		{name: "None",
+			expOut: "No items found\n",
+			body:   `{"results": [], "total_results": 0}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/todo/search" || r.URL.Query().Get("q") != "cafe inv" {
+					t.Errorf("Expected search for %q, got %s", "cafe inv", r.URL)
+				}
+				fmt.Fprintln(w, tc.body)
+			})
+			defer cleanUp()
+			var out bytes.Buffer
+			if err := searchAction(&out, url, "cafe inv", "[", "]"); err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if tc.expOut != out.String() {
+				t.Errorf("Expected out %q, got %q", tc.expOut, out.String())
+			}
+		})
+	}
+}
+
+func TestStatsAction(t *testing.T) {
+	testCases := []struct {
+		name      string
+		asJSON    bool
+		expAccept string
+		body      string
+		expOut    string
+	}{
+		{name: "Text", expAccept: "text/plain",
+			body:   "Items:            2 (1 open, 1 done)\n",
+			expOut: "Items:            2 (1 open, 1 done)\n"},
+		{name: "JSON", asJSON: true, expAccept: "application/json",
+			body:   `{"total":2,"open":1}`,
+			expOut: "{\n  \"total\": 2,\n  \"open\": 1\n}\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/todo/stats" || r.Header.Get("Accept") != tc.expAccept {
+					t.Errorf("Expected %s for /todo/stats, got %s for %s", tc.expAccept, r.Header.Get("Accept"), r.URL.Path)
+				}
+				fmt.Fprint(w, tc.body)
+			})
+			defer cleanUp()
+			var out bytes.Buffer
+			if err := statsAction(&out, url, tc.asJSON); err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if out.String() != tc.expOut {
+				t.Errorf("Expected out %q, got %q", tc.expOut, out.String())
+			}
+		})
+	}
+}
+
+func TestChartAction(t *testing.T) {
+	const svg = `<?xml version="1.0" encoding="UTF-8"?>` + "\n<svg></svg>\n"
+	testCases := []struct {
+		name     string
+		chart    string
+		days     int
+		toFile   bool
+		expQuery string
+		expErr   error
+	}{
+		{name: "Stdout", chart: "heatmap"},
+		{name: "File", chart: "burndown", days: 7, toFile: true, expQuery: "days=7"},
+		{name: "Unknown", chart: "pie", expErr: ErrInvalid},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/todo/charts/"+tc.chart+".svg" || r.URL.RawQuery != tc.expQuery {
+					t.Errorf("Unexpected request %s", r.URL)
+				}
+				w.Header().Set("Content-Type", "image/svg+xml")
+				fmt.Fprint(w, svg)
+			})
+			defer cleanUp()
+			outFile := ""
+			if tc.toFile {
+				outFile = filepath.Join(t.TempDir(), "chart.svg")
+			}
+			var out bytes.Buffer
+			err := chartAction(&out, url, tc.chart, outFile, tc.days)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("Expected error %q, got %v", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if !tc.toFile {
+				if out.String() != svg {
+					t.Errorf("Expected the SVG on STDOUT, got %q", out.String())
+				}
+				return
+			}
+			expOut := fmt.Sprintf("Chart %s written to %s\n", tc.chart, outFile)
+			if out.String() != expOut {
+				t.Errorf("Expected out %q, got %q", expOut, out.String())
+			}
+			data, err := os.ReadFile(outFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != svg {
+				t.Errorf("Expected the SVG in %s, got %q", outFile, data)
+			}
+		})
+	}
+}
+
+func TestReportAction(t *testing.T) {
+	testCases := []struct {
+		name     string
+		since    string
+		format   string
+		expQuery string
+		expErr   error
+	}{
+		{name: "Markdown", since: "7d", format: "md", expQuery: "format=md&since=7d"},
+		{name: "HTML", since: "2026-10-12", format: "html", expQuery: "format=html&since=2026-10-12"},
+		{name: "BadFormat", since: "7d", format: "pdf", expErr: ErrInvalid},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/todo/report" || r.URL.RawQuery != tc.expQuery {
+					t.Errorf("Expected /todo/report?%s, got %s", tc.expQuery, r.URL)
+				}
+				fmt.Fprint(w, "# Todo report\n")
+			})
+			defer cleanUp()
+			var out bytes.Buffer
+			err := reportAction(&out, url, tc.since, tc.format)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("Expected error %q, got %v", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if out.String() != "# Todo report\n" {
+				t.Errorf("Expected the report, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestStartAction(t *testing.T) {
+	testCases := []struct {
+		name    string
+		arg     string
+		status  int
+		expBody string
+		expOut  string
+		expErr  error
+	}{
+		{name: "Started", arg: "2", status: http.StatusCreated, expBody: `{"id":2,"note":"review"}`,
+			expOut: "Timer started on item 2: Task_2\n"},
+		{name: "Running", arg: "1", status: http.StatusConflict, expBody: `{"id":1,"note":"review"}`,
+			expErr: ErrTimerRunning},
+		{name: "NotNumber", arg: "a", expErr: ErrNotNumber},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.Method != http.MethodPost || r.URL.Path != "/todo/timer" || string(body) != tc.expBody {
+					t.Errorf("Expected POST /todo/timer %s, got %s %s %s", tc.expBody, r.Method, r.URL.Path, body)
+				}
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, `{"id":2,"task":"Task_2","start":"2026-10-19T09:00:00Z","duration_seconds":0,"note":"review"}`)
+			})
+			defer cleanUp()
+			var out bytes.Buffer
+			err := startAction(&out, url, tc.arg, "review")
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("Expected error %q, got %v", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if out.String() != tc.expOut {
+				t.Errorf("Expected out %q, got %q", tc.expOut, out.String())
+			}
+		})
+	}
+}
+
+func TestStopAction(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		expOut string
+		expErr error
+	}{
+		{name: "Stopped", status: http.StatusOK, expOut: "Timer stopped on item 2 after 1h30m: Task_2\n"},
+		{name: "NoTimer", status: http.StatusNotFound, expErr: ErrNoTimer},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete || r.URL.Path != "/todo/timer" {
+					t.Errorf("Expected DELETE /todo/timer, got %s %s", r.Method, r.URL.Path)
+				}
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, `{"id":2,"task":"Task_2","start":"2026-10-19T09:00:00Z","stop":"2026-10-19T10:30:00Z","duration_seconds":5400,"note":""}`)
+			})
+			defer cleanUp()
+			var out bytes.Buffer
+			err := stopAction(&out, url)
+			if tc.expErr != nil {
+				if !errors.Is(err, tc.expErr) {
+					t.Fatalf("Expected error %q, got %v", tc.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if out.String() != tc.expOut {
+				t.Errorf("Expected out %q, got %q", tc.expOut, out.String())
+			}
+		})
+	}
+}
+
+func TestTimesheetAction(t *testing.T) {
+	for _, week := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Week=%t", week), func(t *testing.T) {
+			expQuery := "period=day&format=text"
+			if week {
+				expQuery = "period=week&format=text"
+			}
+			url, cleanUp := mockServer(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/todo/timesheet" || r.URL.RawQuery != expQuery {
+					t.Errorf("Expected /todo/timesheet?%s, got %s", expQuery, r.URL)
+				}
+				fmt.Fprint(w, "Timesheet Mon Oct 19, 2026\n")
+			})
+			defer cleanUp()
+			var out bytes.Buffer
+			if err := timesheetAction(&out, url, week); err != nil {
+				t.Fatalf("Expect NO error, got %s", err)
+			}
+			if out.String() != "Timesheet Mon Oct 19, 2026\n" {
+				t.Errorf("Expected the timesheet, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestPrintOneTimeSpent(t *testing.T) {
+	start := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	i := item{Task: "Task_1", CreatedAt: start, TimeEntries: []timeEntry{
+		{Start: start, Stop: start.Add(90 * time.Minute), Duration: 5400},
+		{Start: start.Add(25 * time.Hour), Stop: start.Add(26 * time.Hour), Duration: 3600},
+	}}
+	var out bytes.Buffer
+	if err := printOne(&out, i); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "Time spent:   2h30m in 2 entries\n"; !strings.HasSuffix(out.String(), exp) {
+		t.Errorf("Expected %q, got %q", exp, out.String())
+	}
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The response cache keeps at most cacheMaxEntries responses of up to
+// cacheMaxBody bytes each, dropping the least recently used first.
+const (
+	cacheMaxEntries = 64
+	cacheMaxBody    = 1 << 20
+)
+
+// defaultCacheDir is where responses are cached unless the cache-dir
+// option says otherwise, "" when the system has no cache directory.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "todo_client")
+}
+
+// cacheEntry is a cached GET response and its validators.
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// cacheTransport asks for compressed responses and decodes them. With a
+// dir it keeps GET responses that carry an ETag or Last-Modified there,
+// and revalidates them so an unchanged list is not sent again.
+type cacheTransport struct {
+	dir  string
+	base http.RoundTripper
+}
+
+func (t *cacheTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Accept-Encoding", "zstd, gzip")
+
+	var (
+		path  string
+		entry *cacheEntry
+	)
+	if t.dir != "" && r.Method == http.MethodGet {
+		path = t.entryPath(r)
+		entry = readCacheEntry(path)
+	}
+	if entry != nil {
+		if entry.ETag != "" {
+			r.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			r.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	switch {
+	case entry != nil && resp.StatusCode == http.StatusNotModified:
+		resp.Body.Close()
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return entry.response(r, resp), nil
+	case path != "" && resp.StatusCode == http.StatusOK &&
+		(resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""):
+		body, err := io.ReadAll(io.LimitReader(resp.Body, cacheMaxBody+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if len(body) <= cacheMaxBody {
+			t.store(path, &cacheEntry{
+				URL:          r.URL.String(),
+				ETag:         resp.Header.Get("ETag"),
+				LastModified: resp.Header.Get("Last-Modified"),
+				Header:       http.Header{"Content-Type": resp.Header.Values("Content-Type")},
+				Body:         body,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// entryPath names the entry of r's URL after hashing it with the
+// credentials, so users sharing a machine do not see each other's lists.
+func (t *cacheTransport) entryPath(r *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s", r.Header.Get("Authorization"), r.Header.Get("Accept"), r.URL)
+	return filepath.Join(t.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+func readCacheEntry(path string) *cacheEntry {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil
+	}
+	return &e
+}
+
+// store writes e to path and prunes the cache. The cache only saves
+// requests, so failing to write it is not an error.
+func (t *cacheTransport) store(path string, e *cacheEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(t.dir, "entry-*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || os.Rename(f.Name(), path) != nil {
+		os.Remove(f.Name())
+		return
+	}
+	t.prune()
+}
+
+// prune removes the least recently used entries beyond cacheMaxEntries.
+func (t *cacheTransport) prune() {
+	files, err := filepath.Glob(filepath.Join(t.dir, "*.json"))
+	if err != nil || len(files) <= cacheMaxEntries {
+		return
+	}
+	used := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			used[f] = fi.ModTime()
+		}
+	}
+	slices.SortFunc(files, func(a, b string) int {
+		return used[a].Compare(used[b])
+	})
+	for _, f := range files[:len(files)-cacheMaxEntries] {
+		os.Remove(f)
+	}
+}
+
+// response rebuilds the cached response for r, with the headers of the
+// 304 the server answered r with.
+func (e *cacheEntry) response(r *http.Request, notModified *http.Response) *http.Response {
+	h := notModified.Header.Clone()
+	for k, v := range e.Header {
+		h[k] = v
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
+
+// decodedBody closes the decoder along with the response body.
+type decodedBody struct {
+	io.Reader
+	closeDecoder func()
+	body         io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	b.closeDecoder()
+	return b.body.Close()
+}
+
+// decodeBody replaces a gzip or zstd response body with the decoded one.
+func decodeBody(resp *http.Response) error {
+	var (
+		dec      io.Reader
+		closeDec func()
+	)
+	switch resp.Header.Get("Content-Encoding") {
+	case "":
+		return nil
+	case "gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+		}
+		dec, closeDec = zr, func() { zr.Close() }
+	case "zstd":
+		zr, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+		}
+		dec, closeDec = zr, zr.Close
+	default:
+		return fmt.Errorf("%w: unsupported Content-Encoding %q", ErrInvalidResponse, resp.Header.Get("Content-Encoding"))
+	}
+	resp.Body = &decodedBody{Reader: dec, closeDecoder: closeDec, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// chartCmd represents the chart command
+var chartCmd = &cobra.Command{
+	Use:          "chart <burndown|heatmap>",
+	Short:        "Save a chart of the list as SVG",
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	ValidArgs:    []string{"burndown", "heatmap"},
+	Long: `Save a chart of the list as a standalone SVG image. burndown draws
+the open items at the end of each of the last --days days, heatmap the
+items completed on each day of the last year. Without --out the SVG is
+written to STDOUT.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		outFile, err := cmd.Flags().GetString("out")
+		if err != nil {
+			return err
+		}
+		days, err := cmd.Flags().GetInt("days")
+		if err != nil {
+			return err
+		}
+		return chartAction(os.Stdout, apiUrl, args[0], outFile, days)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(chartCmd)
+	chartCmd.Flags().StringP("out", "o", "", "SVG file to write")
+	chartCmd.Flags().Int("days", 0, "Days of the burndown chart, 2 to 365 (default 30)")
+}
+
+func chartAction(out io.Writer, url, name, outFile string, days int) error {
+	if name != "burndown" && name != "heatmap" {
+		return fmt.Errorf("%w: unknown chart %q, use burndown or heatmap", ErrInvalid, name)
+	}
+	svg, err := getChart(url, name, days)
+	if err != nil {
+		return err
+	}
+	if outFile == "" {
+		_, err = out.Write(svg)
+		return err
+	}
+	if err := os.WriteFile(outFile, svg, 0o644); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Chart %s written to %s\n", name, outFile)
+	return err
+}
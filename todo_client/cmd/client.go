@@ -2,23 +2,40 @@ package cmd
 
 import (
 	"bytes"
-
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/spf13/viper"
 )
 
 const timeFormat = "Jan/02 @15:04"
 
+// maxBatchOps is the most operations the server takes in one batch, so
+// the most item numbers a command can act on.
+const maxBatchOps = 1000
+
 var (
 	ErrConnection      = errors.New("Connection error")
 	ErrNotFound        = errors.New("Not found")
 	ErrInvalidResponse = errors.New("Invalid response")
 	ErrInvalid         = errors.New("Invalid data")
 	ErrNotNumber       = errors.New("Not a number")
+	ErrTLSConfig       = errors.New("Invalid TLS configuration")
+	ErrTimerRunning    = errors.New("A timer is already running")
+	ErrNoTimer         = errors.New("No timer is running")
 )
 
 type item struct {
@@ -26,6 +43,54 @@ type item struct {
 	Done        bool
 	CreatedAt   time.Time
 	CompletedAt time.Time
+	TimeEntries []timeEntry
+}
+
+// timeEntry is time spent on an item, Stop is zero while it runs.
+type timeEntry struct {
+	Start    time.Time
+	Stop     time.Time
+	Duration float64
+	Note     string
+}
+
+// timeSpent returns the time logged on i, a running timer until now.
+func (i item) timeSpent(now time.Time) time.Duration {
+	var total time.Duration
+	for _, e := range i.TimeEntries {
+		if e.Stop.IsZero() {
+			total += now.Sub(e.Start)
+			continue
+		}
+		total += time.Duration(e.Duration * float64(time.Second))
+	}
+	return total
+}
+
+// formatDuration rounds d as the server does, e.g. "3d4h", "2h" or "25m".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		days, hours := d/(24*time.Hour), (d%(24*time.Hour))/time.Hour
+		if hours == 0 {
+			return fmt.Sprintf("%dd", days)
+		}
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case d >= time.Minute:
+		s := strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+		if strings.HasSuffix(s, "h0m") {
+			s = strings.TrimSuffix(s, "0m")
+		}
+		return s
+	}
+	return d.Round(time.Second).String()
+}
+
+// trashedItem is a deleted item with the number it had in the list.
+type trashedItem struct {
+	item
+	Position  int
+	DeletedAt time.Time
 }
 
 type response struct {
@@ -34,15 +99,72 @@ type response struct {
 	TotalResults int    `json:"total_results"`
 }
 
-func newClient() *http.Client {
+// authTransport adds the API token to every request.
+type authTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
+
+func newClient() (*http.Client, error) {
+	tlsCfg, err := clientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+
+	cache := &cacheTransport{dir: viper.GetString("cache-dir"), base: transport}
+
 	c := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   10 * time.Second,
+		Transport: cache,
+	}
+	if token := viper.GetString("token"); token != "" {
+		c.Transport = &authTransport{token: token, base: cache}
 	}
-	return c
+	return c, nil
+}
+
+// clientTLSConfig builds the TLS settings from the ca-cert, client-cert,
+// client-key and insecure options.
+func clientTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: viper.GetBool("insecure"),
+	}
+	if caFile := viper.GetString("ca-cert"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrTLSConfig, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrTLSConfig, caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	certFile, keyFile := viper.GetString("client-cert"), viper.GetString("client-key")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrTLSConfig, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
 }
 
 func getItems(url string) ([]item, error) {
-	r, err := newClient().Get(url)
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrConnection, err)
 	}
@@ -90,11 +212,21 @@ func sendRequest(url, method, contentType string,
 		return err
 	}
 	request.Header.Set("Content-Type", contentType)
-	response, err := newClient().Do(request)
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	response, err := c.Do(request)
 	if err != nil {
 		return err
 	}
 	defer response.Body.Close()
+	return checkStatus(response, expStatus)
+}
+
+// checkStatus turns an unexpected response into an error carrying the
+// response body.
+func checkStatus(response *http.Response, expStatus int) error {
 	if response.StatusCode != expStatus {
 		msg, err := io.ReadAll(response.Body)
 		if err != nil {
@@ -109,6 +241,57 @@ func sendRequest(url, method, contentType string,
 	return nil
 }
 
+// Requests that carry an Idempotency-Key are sent up to retryAttempts
+// times, waiting retryDelay times the attempt number in between.
+var (
+	retryAttempts = 3
+	retryDelay    = time.Second
+)
+
+// postIdempotent POSTs a JSON body with a new Idempotency-Key and sends
+// it again with the same key after connection errors and timeouts, server
+// errors and answers that ask to retry later. The server applies it once.
+func postIdempotent(url string, body []byte) (*http.Response, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Idempotency-Key", hex.EncodeToString(key))
+
+		wait := retryDelay * time.Duration(attempt)
+		response, err := c.Do(request)
+		switch {
+		case err != nil:
+			if attempt >= retryAttempts {
+				return nil, fmt.Errorf("%w: %s", ErrConnection, err)
+			}
+		case response.StatusCode >= http.StatusInternalServerError,
+			(response.StatusCode == http.StatusConflict || response.StatusCode == http.StatusTooManyRequests) &&
+				response.Header.Get("Retry-After") != "":
+			if attempt >= retryAttempts {
+				return response, nil
+			}
+			if secs, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		default:
+			return response, nil
+		}
+		time.Sleep(wait)
+	}
+}
+
 func addItem(apiUrl, task string) error {
 	u := fmt.Sprintf("%s/todo", apiUrl)
 
@@ -118,12 +301,16 @@ func addItem(apiUrl, task string) error {
 		Task: task,
 	}
 
-	var buffer bytes.Buffer
-	if err := json.NewEncoder(&buffer).Encode(item); err != nil {
+	body, err := json.Marshal(item)
+	if err != nil {
 		return err
 	}
-	return sendRequest(u, http.MethodPost, "application/json",
-		http.StatusCreated, &buffer)
+	response, err := postIdempotent(u, append(body, '\n'))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return checkStatus(response, http.StatusCreated)
 }
 
 func completeItem(apiUrl string, id int) error {
@@ -135,3 +322,329 @@ func deleteItem(apiUrl string, id int) error {
 	u := fmt.Sprintf("%s/todo/%d", apiUrl, id)
 	return sendRequest(u, http.MethodDelete, "", http.StatusNoContent, nil)
 }
+
+func getTrash(apiUrl string) ([]trashedItem, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.Get(fmt.Sprintf("%s/todo/trash", apiUrl))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Results []trashedItem `json:"results"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+	}
+	return resp.Results, nil
+}
+
+// searchResult is an item found by a search. Matches are byte ranges of
+// the task.
+type searchResult struct {
+	ID      int    `json:"id"`
+	Task    string `json:"task"`
+	Done    bool   `json:"done"`
+	Matches []struct {
+		Start int `json:"start"`
+		End   int `json:"end"`
+	} `json:"matches"`
+}
+
+func searchItems(apiUrl, query string) ([]searchResult, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.Get(fmt.Sprintf("%s/todo/search?q=%s", apiUrl, url.QueryEscape(query)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Results []searchResult `json:"results"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+	}
+	return resp.Results, nil
+}
+
+// getStats returns the statistics of the list in mediaType, a text
+// report or JSON.
+func getStats(apiUrl, mediaType string) ([]byte, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/todo/stats", apiUrl), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", mediaType)
+	r, err := c.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r.Body)
+}
+
+// getReport returns the report of the list since the start of the period
+// in since, e.g. "7d", as Markdown ("md") or HTML ("html").
+func getReport(apiUrl, since, format string) ([]byte, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{"since": {since}, "format": {format}}
+	r, err := c.Get(fmt.Sprintf("%s/todo/report?%s", apiUrl, q.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r.Body)
+}
+
+// timer is the running timer of the list, or the one just stopped.
+type timer struct {
+	ID       int        `json:"id"`
+	Task     string     `json:"task"`
+	Start    time.Time  `json:"start"`
+	Stop     *time.Time `json:"stop"`
+	Duration float64    `json:"duration_seconds"`
+	Note     string     `json:"note"`
+}
+
+func decodeTimer(r *http.Response) (timer, error) {
+	var t timer
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		return timer{}, fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+	}
+	return t, nil
+}
+
+// startTimer starts a timer on item id. The list runs one at a time.
+func startTimer(apiUrl string, id int, note string) (timer, error) {
+	body, err := json.Marshal(struct {
+		ID   int    `json:"id"`
+		Note string `json:"note,omitempty"`
+	}{id, note})
+	if err != nil {
+		return timer{}, err
+	}
+	r, err := postIdempotent(fmt.Sprintf("%s/todo/timer", apiUrl), body)
+	if err != nil {
+		return timer{}, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusConflict {
+		return timer{}, fmt.Errorf("%w, stop it first", ErrTimerRunning)
+	}
+	if err := checkStatus(r, http.StatusCreated); err != nil {
+		return timer{}, err
+	}
+	return decodeTimer(r)
+}
+
+// stopTimer stops the running timer and returns it.
+func stopTimer(apiUrl string) (timer, error) {
+	c, err := newClient()
+	if err != nil {
+		return timer{}, err
+	}
+	request, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/todo/timer", apiUrl), nil)
+	if err != nil {
+		return timer{}, err
+	}
+	r, err := c.Do(request)
+	if err != nil {
+		return timer{}, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusNotFound {
+		return timer{}, ErrNoTimer
+	}
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return timer{}, err
+	}
+	return decodeTimer(r)
+}
+
+// getTimesheet returns the time logged today, or this week with week,
+// as a text table.
+func getTimesheet(apiUrl string, week bool) ([]byte, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	period := "day"
+	if week {
+		period = "week"
+	}
+	r, err := c.Get(fmt.Sprintf("%s/todo/timesheet?period=%s&format=text", apiUrl, period))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r.Body)
+}
+
+// getChart returns the SVG of chart name, "burndown" or "heatmap". days
+// sets the days of the burndown chart, 0 keeps the server default.
+func getChart(apiUrl, name string, days int) ([]byte, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/todo/charts/%s.svg", apiUrl, url.PathEscape(name))
+	if days > 0 {
+		u += fmt.Sprintf("?days=%d", days)
+	}
+	r, err := c.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r.Body)
+}
+
+// restoreItem puts trashed item id back into the list and returns the
+// item number it got there.
+func restoreItem(apiUrl string, id int) (int, error) {
+	c, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	r, err := c.Post(fmt.Sprintf("%s/todo/trash/%d/restore", apiUrl, id), "", nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+	if err := checkStatus(r, http.StatusOK); err != nil {
+		return 0, err
+	}
+	pos, err := strconv.Atoi(strings.TrimPrefix(r.Header.Get("Location"), "/todo/"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad Location %q", ErrInvalidResponse, r.Header.Get("Location"))
+	}
+	return pos, nil
+}
+
+// batchOp is one operation of a batch request. IDs refer to the list as
+// it was before the batch.
+type batchOp struct {
+	Op   string `json:"op"`
+	ID   int    `json:"id,omitempty"`
+	Task string `json:"task,omitempty"`
+}
+
+// batchItems applies ops in a single request. The server applies all of
+// them or none.
+func batchItems(apiUrl string, ops []batchOp) error {
+	u := fmt.Sprintf("%s/todo/batch", apiUrl)
+
+	body, err := json.Marshal(struct {
+		Operations []batchOp `json:"operations"`
+	}{ops})
+	if err != nil {
+		return err
+	}
+	r, err := postIdempotent(u, body)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode == http.StatusOK {
+		return nil
+	}
+	msg, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("Fail to read body: %w", err)
+	}
+	if r.StatusCode == http.StatusUnprocessableEntity {
+		var resp struct {
+			Results []struct {
+				Op     string `json:"op"`
+				ID     int    `json:"id"`
+				Status string `json:"status"`
+				Error  string `json:"error"`
+			} `json:"results"`
+		}
+		// A 422 without a failed operation, such as a reused
+		// Idempotency-Key, carries its reason as text.
+		json.Unmarshal(msg, &resp)
+		for _, res := range resp.Results {
+			if res.Status == "failed" {
+				return fmt.Errorf("%w, nothing changed: %s %d: %s", ErrInvalidResponse, res.Op, res.ID, res.Error)
+			}
+		}
+	}
+	return fmt.Errorf("%w, %s", ErrInvalidResponse, msg)
+}
+
+// parseIDs reads item numbers given as separate arguments, comma
+// separated lists or ranges like 5-9. The result is sorted without
+// duplicates and holds at most maxBatchOps numbers.
+func parseIDs(args []string) ([]int, error) {
+	var ids []int
+	for _, arg := range args {
+		for _, part := range strings.Split(arg, ",") {
+			from, to, isRange := strings.Cut(part, "-")
+			first, err := strconv.Atoi(from)
+			if err != nil || first < 1 {
+				return nil, fmt.Errorf("%w: %q is not an item number", ErrNotNumber, part)
+			}
+			last := first
+			if isRange {
+				last, err = strconv.Atoi(to)
+				if err != nil || last < first {
+					return nil, fmt.Errorf("%w: %q is not a range of item numbers", ErrNotNumber, part)
+				}
+				if last-first >= maxBatchOps {
+					return nil, fmt.Errorf("%w: range %q has more than %d items", ErrInvalid, part, maxBatchOps)
+				}
+			}
+			for id := first; id <= last; id++ {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) > maxBatchOps {
+		return nil, fmt.Errorf("%w: more than %d items", ErrInvalid, maxBatchOps)
+	}
+	return ids, nil
+}
+
+// formatIDs joins item numbers for messages.
+func formatIDs(ids []int) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ", ")
+}
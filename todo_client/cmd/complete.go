@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,12 +16,14 @@ import (
 
 // completeCmd represents the complete command
 var completeCmd = &cobra.Command{
-	Use:          "complete <item No>",
-	Short:        "Set the item as completed",
+	Use:          "complete <item No>...",
+	Short:        "Set items as completed",
 	Aliases:      []string{"c"},
-	Args:         cobra.ExactArgs(1),
+	Args:         cobra.MinimumNArgs(1),
 	SilenceUsage: true,
-	Long:         ``,
+	Long: `Set one or more items as completed. Items are numbers, comma
+separated lists or ranges, e.g. "complete 1 3 5-9". Several items are
+completed in one batch request, all of them or none.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		apiUrl := viper.GetString("api-url")
 		return completeAction(os.Stdout, apiUrl, args)
@@ -34,14 +35,26 @@ func init() {
 }
 
 func completeAction(w io.Writer, url string, args []string) error {
-	id, err := strconv.Atoi(args[0])
+	ids, err := parseIDs(args)
 	if err != nil {
-		return fmt.Errorf("%w Argument must be a number.", ErrNotNumber)
+		return err
+	}
+	if len(ids) == 1 {
+		if err := completeItem(url, ids[0]); err != nil {
+			return err
+		}
+		return printComplete(w, ids[0])
 	}
-	if err := completeItem(url, id); err != nil {
+
+	ops := make([]batchOp, len(ids))
+	for i, id := range ids {
+		ops[i] = batchOp{Op: "complete", ID: id}
+	}
+	if err := batchItems(url, ops); err != nil {
 		return err
 	}
-	return printComplete(w, id)
+	_, err = fmt.Fprintf(w, "Items No %s set as completed", formatIDs(ids))
+	return err
 }
 
 func printComplete(w io.Writer, id int) error {
@@ -78,6 +78,48 @@ var testServerResponse = map[string]struct {
 		Status: http.StatusNoContent,
 		Body:   "",
 	},
+	"trashOne": {
+		Status: http.StatusOK,
+		Body: `{
+			"results": [
+			{
+			"Task": "Task_1",
+			"Done": true,
+			"CreatedAt": "2019-10-28T08:23:38.310097076-04:00",
+			"CompletedAt": "2019-10-28T09:00:00Z",
+			"Position": 2,
+			"DeletedAt": "2019-10-29T10:30:00Z"
+			}
+			],
+			"total_results": 1
+			}`,
+	},
+	"noTrash": {
+		Status: http.StatusOK,
+		Body:   `{"results": [], "total_results": 0}`,
+	},
+	"batchApplied": {
+		Status: http.StatusOK,
+		Body: `{
+			"applied": true,
+			"results": [
+			{"op": "complete", "id": 1, "status": "applied"},
+			{"op": "complete", "id": 3, "status": "applied"}
+			],
+			"total_results": 2
+			}`,
+	},
+	"batchFailed": {
+		Status: http.StatusUnprocessableEntity,
+		Body: `{
+			"applied": false,
+			"results": [
+			{"op": "delete", "id": 1, "status": "skipped"},
+			{"op": "delete", "id": 9, "status": "failed", "error": "Not Found: item 9"}
+			],
+			"total_results": 2
+			}`,
+	},
 }
 
 func mockServer(h http.HandlerFunc) (string, func()) {
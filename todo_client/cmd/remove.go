@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,12 +16,14 @@ import (
 
 // removeCmd represents the remove command
 var removeCmd = &cobra.Command{
-	Use:          "remove <item id>",
-	Short:        "Delete item by id",
+	Use:          "remove <item id>...",
+	Short:        "Delete items by id",
 	Aliases:      []string{"d"},
 	SilenceUsage: true,
-	Args:         cobra.ExactArgs(1),
-	Long:         ``,
+	Args:         cobra.MinimumNArgs(1),
+	Long: `Delete one or more items. Items are numbers, comma separated lists
+or ranges, e.g. "remove 2 4-6". The numbers are those shown by list
+before the command runs.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		apiUrl := viper.GetString("api-url")
 		return removeAction(os.Stdout, apiUrl, args)
@@ -34,14 +35,26 @@ func init() {
 }
 
 func removeAction(w io.Writer, url string, args []string) error {
-	id, err := strconv.Atoi(args[0])
+	ids, err := parseIDs(args)
 	if err != nil {
-		return fmt.Errorf("%w, Arg must be a number", ErrNotNumber)
+		return err
+	}
+	if len(ids) == 1 {
+		if err := deleteItem(url, ids[0]); err != nil {
+			return err
+		}
+		return printDelete(w, ids[0])
 	}
-	if err := deleteItem(url, id); err != nil {
+
+	ops := make([]batchOp, len(ids))
+	for i, id := range ids {
+		ops[i] = batchOp{Op: "delete", ID: id}
+	}
+	if err := batchItems(url, ops); err != nil {
 		return err
 	}
-	return printDelete(w, id)
+	_, err = fmt.Fprintf(w, "Items No %s removed", formatIDs(ids))
+	return err
 }
 
 func printDelete(w io.Writer, id int) error {
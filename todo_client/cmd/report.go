@@ -0,0 +1,56 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:          "report",
+	Short:        "Print a report of the list for stand-ups",
+	SilenceUsage: true,
+	Long: `Print the items completed and added since --since, the overdue items,
+still open and added before that, and the oldest open items. --since takes
+days (7d), weeks (2w), a duration (36h) or a date (2026-10-12). The server
+renders the report from its Markdown or HTML template, see -report-templates.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		since, err := cmd.Flags().GetString("since")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		return reportAction(os.Stdout, apiUrl, since, format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().String("since", "7d", "Start of the period")
+	reportCmd.Flags().String("format", "md", "Report format: md or html")
+}
+
+func reportAction(out io.Writer, url, since, format string) error {
+	if format != "md" && format != "html" {
+		return fmt.Errorf("%w: unknown format %q, use md or html", ErrInvalid, format)
+	}
+	report, err := getReport(url, since, format)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(report)
+	return err
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:          "restore <trash No>...",
+	Short:        "Put deleted items back into the list",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	Long: `Restore one or more deleted items, by the numbers shown by trash.
+Items are numbers, comma separated lists or ranges, e.g. "restore 1 3-4".
+Each item goes back to the number it had, or to the end of a list that
+got shorter since.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		return restoreAction(os.Stdout, apiUrl, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func restoreAction(w io.Writer, url string, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	// Restoring the latest deletions first keeps the numbers of the
+	// others, and undoes the deletions in reverse.
+	slices.Reverse(ids)
+	for _, id := range ids {
+		pos, err := restoreItem(url, id)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "Item %d restored as item No %d\n", id, pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -43,6 +43,12 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.todo_client.yaml)")
 	rootCmd.PersistentFlags().String("api-url", "http://127.0.0.1:8080", "Todo API URL")
+	rootCmd.PersistentFlags().String("token", "", "Todo API token for per-user lists")
+	rootCmd.PersistentFlags().String("ca-cert", "", "CA certificate file to verify the server")
+	rootCmd.PersistentFlags().String("client-cert", "", "Client certificate file for mutual TLS")
+	rootCmd.PersistentFlags().String("client-key", "", "Client private key file for mutual TLS")
+	rootCmd.PersistentFlags().Bool("insecure", false, "Skip server certificate verification")
+	rootCmd.PersistentFlags().String("cache-dir", defaultCacheDir(), "Directory to cache responses in, empty to disable the cache")
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
@@ -53,6 +59,12 @@ func init() {
 	viper.SetEnvPrefix("TODO")
 
 	viper.BindPFlag("api-url", rootCmd.PersistentFlags().Lookup("api-url"))
+	viper.BindPFlag("token", rootCmd.PersistentFlags().Lookup("token"))
+	viper.BindPFlag("ca-cert", rootCmd.PersistentFlags().Lookup("ca-cert"))
+	viper.BindPFlag("client-cert", rootCmd.PersistentFlags().Lookup("client-cert"))
+	viper.BindPFlag("client-key", rootCmd.PersistentFlags().Lookup("client-key"))
+	viper.BindPFlag("insecure", rootCmd.PersistentFlags().Lookup("insecure"))
+	viper.BindPFlag("cache-dir", rootCmd.PersistentFlags().Lookup("cache-dir"))
 }
 
 func initConfig() {
@@ -0,0 +1,79 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:          "search <word>...",
+	Short:        "Find items by words, best matches first",
+	Aliases:      []string{"s"},
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	Long: `Show the items holding every word given, as a whole word or the
+start of one, ignoring case and accents: "search cafe inv" finds "Pay the
+Café invoice". The matched words are shown in bold on a terminal and
+between brackets otherwise.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		open, close := "[", "]"
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			open, close = "\x1b[1m", "\x1b[0m"
+		}
+		return searchAction(os.Stdout, apiUrl, strings.Join(args, " "), open, close)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+}
+
+func searchAction(out io.Writer, url, query, open, close string) error {
+	results, err := searchItems(url, query)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		_, err := fmt.Fprintln(out, "No items found")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 4, 2, 0, ' ', 0)
+	for _, r := range results {
+		done := "-"
+		if r.Done {
+			done = "X"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", done, r.ID, highlight(r, open, close))
+	}
+	return w.Flush()
+}
+
+// highlight puts the matched words of r between open and close, ignoring
+// ranges that do not fit the task.
+func highlight(r searchResult, open, close string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range r.Matches {
+		if m.Start < last || m.End > len(r.Task) || m.Start >= m.End {
+			continue
+		}
+		b.WriteString(r.Task[last:m.Start])
+		b.WriteString(open + r.Task[m.Start:m.End] + close)
+		last = m.End
+	}
+	b.WriteString(r.Task[last:])
+	return b.String()
+}
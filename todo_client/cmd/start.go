@@ -0,0 +1,52 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// startCmd represents the start command
+var startCmd = &cobra.Command{
+	Use:          "start <id>",
+	Short:        "Start a timer on an item",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	Long: `Start logging time on an item until stop, or until the item is completed
+or deleted. Only one timer runs at a time. --note says what the time is for.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		note, err := cmd.Flags().GetString("note")
+		if err != nil {
+			return err
+		}
+		return startAction(os.Stdout, apiUrl, args[0], note)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(startCmd)
+	startCmd.Flags().StringP("note", "n", "", "Note for the time entry")
+}
+
+func startAction(out io.Writer, url, arg, note string) error {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("%w: Item ID must be a number", ErrNotNumber)
+	}
+	t, err := startTimer(url, id, note)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "Timer started on item %d: %s\n", t.ID, t.Task)
+	return err
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:          "stats",
+	Short:        "Show completion statistics of the list",
+	SilenceUsage: true,
+	Long: `Show how many items are open and done, the completion rate, the
+median and 90th percentile time from creating an item to completing it,
+the items completed on each of the last days and weeks, and how old the
+open items are. --json prints the statistics as JSON.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+		return statsAction(os.Stdout, apiUrl, asJSON)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().Bool("json", false, "Print the statistics as JSON")
+}
+
+func statsAction(out io.Writer, url string, asJSON bool) error {
+	if !asJSON {
+		report, err := getStats(url, "text/plain")
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(report)
+		return err
+	}
+	body, err := getStats(url, "application/json")
+	if err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+	}
+	_, err = fmt.Fprintln(out, indented.String())
+	return err
+}
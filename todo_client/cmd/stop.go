@@ -0,0 +1,42 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// stopCmd represents the stop command
+var stopCmd = &cobra.Command{
+	Use:          "stop",
+	Short:        "Stop the running timer",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		return stopAction(os.Stdout, apiUrl)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+}
+
+func stopAction(out io.Writer, url string) error {
+	t, err := stopTimer(url)
+	if err != nil {
+		return err
+	}
+	spent := formatDuration(time.Duration(t.Duration * float64(time.Second)))
+	_, err = fmt.Fprintf(out, "Timer stopped on item %d after %s: %s\n", t.ID, spent, t.Task)
+	return err
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// timesheetCmd represents the timesheet command
+var timesheetCmd = &cobra.Command{
+	Use:          "timesheet",
+	Short:        "Show the time logged on items",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	Long: `Show the time logged on each item today, or with --week on each day
+of the week from Monday, with the totals. A running timer counts until now.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		week, err := cmd.Flags().GetBool("week")
+		if err != nil {
+			return err
+		}
+		return timesheetAction(os.Stdout, apiUrl, week)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(timesheetCmd)
+	timesheetCmd.Flags().Bool("week", false, "Show the current week")
+}
+
+func timesheetAction(out io.Writer, url string, week bool) error {
+	ts, err := getTimesheet(url, week)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(ts)
+	return err
+}
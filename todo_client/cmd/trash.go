@@ -0,0 +1,59 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// trashCmd represents the trash command
+var trashCmd = &cobra.Command{
+	Use:          "trash",
+	Short:        "Show deleted items",
+	SilenceUsage: true,
+	Long: `Show the items deleted from the list, oldest first, with the number
+to restore them by, when they were deleted and the item number they
+had. The server purges items after the days it is configured with.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		return trashAction(os.Stdout, apiUrl)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+}
+
+func trashAction(out io.Writer, url string) error {
+	items, err := getTrash(url)
+	if err != nil {
+		return err
+	}
+	return printTrash(out, items)
+}
+
+func printTrash(out io.Writer, items []trashedItem) error {
+	if len(items) == 0 {
+		_, err := fmt.Fprintln(out, "Trash is empty")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 4, 2, 2, ' ', 0)
+	for k, v := range items {
+		done := "-"
+		if v.Done {
+			done = "X"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\tdeleted %s from %d\n", done, k+1, v.Task,
+			v.DeletedAt.Format(timeFormat), v.Position)
+	}
+	return w.Flush()
+}
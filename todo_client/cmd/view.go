@@ -11,6 +11,7 @@ import (
 	"os"
 	"strconv"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -65,5 +66,16 @@ func printOne(out io.Writer, i item) error {
 		fmt.Fprintf(w, "Complited at:\t%s\n", i.CompletedAt.Format(timeFormat))
 	}
 	fmt.Fprintf(w, "Complited:\t%s\n", "No")
+	if n := len(i.TimeEntries); n > 0 {
+		spent := formatDuration(i.timeSpent(time.Now()))
+		if last := i.TimeEntries[n-1]; last.Stop.IsZero() {
+			spent += fmt.Sprintf(" (running since %s)", last.Start.Format(timeFormat))
+		}
+		entries := "entries"
+		if n == 1 {
+			entries = "entry"
+		}
+		fmt.Fprintf(w, "Time spent:\t%s in %d %s\n", spent, n, entries)
+	}
 	return w.Flush()
 }
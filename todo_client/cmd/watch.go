@@ -0,0 +1,188 @@
+/*
+Copyright © 2026 The Pragmatic Programmers LLC
+Copyright apply to this codebase.
+Check license for detailes.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultRetry is the reconnection delay until the server sends one.
+const defaultRetry = 2 * time.Second
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:          "watch",
+	Aliases:      []string{"w"},
+	Short:        "Print changes to the Todo List as they happen",
+	SilenceUsage: true,
+	Long: `Follow the server change stream until interrupted.
+The connection is reopened when it drops, resuming after the last event.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiUrl := viper.GetString("api-url")
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		return watchAction(ctx, os.Stdout, apiUrl)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+}
+
+// event is one message of the change stream.
+type event struct {
+	ID       uint64    `json:"id"`
+	Type     string    `json:"type"`
+	Position int       `json:"position"`
+	To       int       `json:"to"`
+	Item     item      `json:"item"`
+	Time     time.Time `json:"time"`
+}
+
+// eventStream tracks what is needed to resume a stream.
+type eventStream struct {
+	lastID string
+	retry  time.Duration
+}
+
+func watchAction(ctx context.Context, out io.Writer, apiUrl string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	// The stream stays open, only the context ends it.
+	c.Timeout = 0
+
+	s := &eventStream{retry: defaultRetry}
+	for {
+		err := s.read(ctx, c, out, apiUrl+"/todo/events")
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrInvalidResponse) || errors.Is(err, ErrNotFound) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.retry):
+		}
+	}
+}
+
+// read prints the events of one connection until it ends.
+func (s *eventStream) read(ctx context.Context, c *http.Client, out io.Writer, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if s.lastID != "" {
+		req.Header.Set("Last-Event-ID", s.lastID)
+	}
+	r, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrConnection, err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(r.Body)
+		err = ErrInvalidResponse
+		if r.StatusCode == http.StatusNotFound {
+			err = ErrNotFound
+		}
+		return fmt.Errorf("%w, %s", err, msg)
+	}
+
+	var name, data, id string
+	sc := bufio.NewScanner(r.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			if id != "" {
+				s.lastID = id
+			}
+			if name != "" {
+				if err := printEvent(out, name, data); err != nil {
+					return err
+				}
+			}
+			name, data, id = "", "", ""
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			name = value
+		case "data":
+			data = value
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return sc.Err()
+}
+
+func printEvent(out io.Writer, name, data string) error {
+	if name == "stream.reset" {
+		_, err := fmt.Fprintln(out, "Missed changes, run list to reload")
+		return err
+	}
+	var e event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidResponse, err)
+	}
+	at := e.Time.Format(timeFormat)
+	switch e.Type {
+	case "item.added":
+		_, err := fmt.Fprintf(out, "%s added %d: %s\n", at, e.Position, e.Item.Task)
+		return err
+	case "item.completed":
+		_, err := fmt.Fprintf(out, "%s completed %d: %s\n", at, e.Position, e.Item.Task)
+		return err
+	case "item.deleted":
+		_, err := fmt.Fprintf(out, "%s deleted %d: %s\n", at, e.Position, e.Item.Task)
+		return err
+	case "item.edited":
+		_, err := fmt.Fprintf(out, "%s edited %d: %s\n", at, e.Position, e.Item.Task)
+		return err
+	case "item.reordered":
+		_, err := fmt.Fprintf(out, "%s moved %d to %d: %s\n", at, e.Position, e.To, e.Item.Task)
+		return err
+	case "item.restored":
+		_, err := fmt.Fprintf(out, "%s restored %d: %s\n", at, e.Position, e.Item.Task)
+		return err
+	case "timer.started":
+		_, err := fmt.Fprintf(out, "%s started timer on %d: %s\n", at, e.Position, e.Item.Task)
+		return err
+	case "timer.stopped":
+		_, err := fmt.Fprintf(out, "%s stopped timer on %d: %s\n", at, e.Position, e.Item.Task)
+		return err
+	}
+	_, err := fmt.Fprintf(out, "%s %s\n", at, e.Type)
+	return err
+}
@@ -3,6 +3,7 @@ module pragprog.com/rggo/apis/todo_client
 go 1.25.4
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/spf13/cobra v1.10.2
 	github.com/spf13/viper v1.21.0
 )
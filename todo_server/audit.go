@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditGenesis is the prev hash of the first audit entry.
+var auditGenesis = strings.Repeat("0", sha256.Size*2)
+
+// auditOps names the audited operation of each event type.
+var auditOps = map[string]string{
+	eventAdded:        "add",
+	eventCompleted:    "complete",
+	eventDeleted:      "delete",
+	eventEdited:       "edit",
+	eventReordered:    "move",
+	eventRestored:     "restore",
+	eventTimerStarted: "start",
+	eventTimerStopped: "stop",
+}
+
+var ErrAuditChain = errors.New("Audit chain broken")
+
+type remoteAddrKey struct{}
+
+// auditEntry is one line of the audit log. Hash is the SHA-256 of the
+// entry's JSON without the hash, which includes the hash of the entry
+// before it, so editing or dropping a line breaks every hash after it.
+type auditEntry struct {
+	Seq        uint64          `json:"seq"`
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor"`
+	RemoteAddr string          `json:"remote_addr,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Op         string          `json:"op"`
+	Position   int             `json:"position"`
+	To         int             `json:"to,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Prev       string          `json:"prev"`
+	Hash       string          `json:"hash,omitempty"`
+}
+
+func (e auditEntry) sum() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// auditLog appends every change to the lists to a file of hash-chained
+// JSON lines. A nil *auditLog records nothing. Once a change cannot be
+// appended the log is broken: it records nothing more and the stores
+// refuse changes until the server is restarted.
+type auditLog struct {
+	file string
+
+	mu     sync.Mutex
+	seq    uint64
+	last   string
+	broken error
+}
+
+// openAuditLog continues the chain of file, which is created on the
+// first change.
+func openAuditLog(file string) (*auditLog, error) {
+	a := &auditLog{file: file, last: auditGenesis}
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	err = scanAudit(f, func(e auditEntry) error {
+		a.seq, a.last = e.Seq, e.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("audit log %s: %w", file, err)
+	}
+	return a, nil
+}
+
+// record appends change e, made by the caller in ctx, to the log.
+func (a *auditLog) record(ctx context.Context, e event) error {
+	if a == nil {
+		return nil
+	}
+	entry := auditEntry{
+		Time:     e.Time.UTC(),
+		Op:       auditOps[e.Type],
+		Position: e.Position,
+		To:       e.To,
+	}
+	if u, ok := userFromContext(ctx); ok {
+		entry.Actor = u.Name
+	}
+	entry.RemoteAddr, _ = ctx.Value(remoteAddrKey{}).(string)
+	entry.RequestID, _ = ctx.Value(requestIDKey{}).(string)
+
+	before, after := e.Before, e.Item
+	if e.Type == eventDeleted {
+		before, after = e.Item, nil
+	}
+	var err error
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.broken != nil {
+		return a.broken
+	}
+	entry.Seq = a.seq + 1
+	entry.Prev = a.last
+	if entry.Hash, err = entry.sum(); err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := appendLine(a.file, line); err != nil {
+		a.broken = fmt.Errorf("%w: entry %d not written: %s", ErrAuditChain, entry.Seq, err)
+		return a.broken
+	}
+	a.seq, a.last = entry.Seq, entry.Hash
+	return nil
+}
+
+// check returns the error that broke the log, nil while it records.
+func (a *auditLog) check() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.broken
+}
+
+func appendLine(file string, line []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// scanAudit calls fn with every entry of r after checking it continues
+// the chain.
+func scanAudit(r io.Reader, fn func(auditEntry) error) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	seq, last := uint64(0), auditGenesis
+	for s.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return fmt.Errorf("%w: line %d: %s", ErrAuditChain, seq+1, err)
+		}
+		if e.Seq != seq+1 {
+			return fmt.Errorf("%w: line %d: expected entry %d, found %d", ErrAuditChain, seq+1, seq+1, e.Seq)
+		}
+		if e.Prev != last {
+			return fmt.Errorf("%w: entry %d does not follow entry %d", ErrAuditChain, e.Seq, seq)
+		}
+		sum, err := e.sum()
+		if err != nil {
+			return err
+		}
+		if sum != e.Hash {
+			return fmt.Errorf("%w: entry %d was modified", ErrAuditChain, e.Seq)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+		seq, last = e.Seq, e.Hash
+	}
+	return s.Err()
+}
+
+// verifyAudit checks the whole chain of file and returns its length.
+func verifyAudit(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n := 0
+	err = scanAudit(f, func(auditEntry) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// entries returns the entries made at or after since by actor, both
+// optional. It fails when the chain is broken.
+func (a *auditLog) entries(since time.Time, actor string) ([]auditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	results := []auditEntry{}
+	f, err := os.Open(a.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	err = scanAudit(f, func(e auditEntry) error {
+		if !e.Time.Before(since) && (actor == "" || e.Actor == actor) {
+			results = append(results, e)
+		}
+		return nil
+	})
+	return results, err
+}
+
+// auditHandler serves GET /audit. ?since= takes an RFC 3339 time and
+// ?actor= a user name.
+func auditHandler(a *auditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+			return
+		}
+		q := r.URL.Query()
+		var since time.Time
+		if v := q.Get("since"); v != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, v); err != nil {
+				replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("%s: since: %s", ErrInvalidData, err))
+				return
+			}
+		}
+		results, err := a.entries(since, q.Get("actor"))
+		if err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		replyResults(w, r, results, len(results))
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"unicode/utf8"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// maxBatchOps caps the operations of a single batch request.
+const maxBatchOps = 1000
+
+// Batch operations.
+const (
+	batchAdd      = "add"
+	batchComplete = "complete"
+	batchDelete   = "delete"
+	batchEdit     = "edit"
+)
+
+// Batch operation results.
+const (
+	batchApplied = "applied"
+	batchFailed  = "failed"
+	batchSkipped = "skipped"
+)
+
+// batchOp is one operation of a batch. ID is the item number in the list
+// as it was before the batch, so "delete 1, delete 2" removes the first
+// two items.
+type batchOp struct {
+	Op   string `json:"op"`
+	ID   int    `json:"id,omitempty"`
+	Task string `json:"task,omitempty"`
+}
+
+// batchResult reports one operation. ID is the item number after the
+// batch, or the removed number for deletes.
+type batchResult struct {
+	Op     string `json:"op"`
+	ID     int    `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Applied      bool          `json:"applied"`
+	Results      []batchResult `json:"results"`
+	TotalResults int           `json:"total_results"`
+}
+
+// batchHandler applies every operation of the request or none of them.
+// The list is saved once and the events are published after the save.
+func batchHandler(w http.ResponseWriter, r *http.Request, list *todo.List, st *store, lim limits) {
+	if r.Method != http.MethodPost {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	var req struct {
+		Operations []batchOp `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			replyErrorContent(w, r, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %s", err))
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOps {
+		message := fmt.Sprintf("%s: a batch needs 1 to %d operations", ErrInvalidData, maxBatchOps)
+		replyErrorContent(w, r, http.StatusBadRequest, message)
+		return
+	}
+
+	work, results, events, err := applyBatch(*list, req.Operations, lim, st.remove)
+	if err != nil {
+		replyJSON(w, r, http.StatusUnprocessableEntity, batchResponse{
+			Results:      results,
+			TotalResults: len(results),
+		})
+		return
+	}
+	if err := st.commit(r.Context(), &work, events...); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	replyJSON(w, r, http.StatusOK, batchResponse{
+		Applied:      true,
+		Results:      results,
+		TotalResults: len(results),
+	})
+}
+
+// applyBatch runs ops on a copy of list, deleting items with remove. On
+// the first failing operation it stops and returns that operation's
+// error, with the later ones reported as skipped.
+func applyBatch(list todo.List, ops []batchOp, lim limits, remove func(*todo.List, int) error) (todo.List, []batchResult, []event, error) {
+	work := slices.Clone(list)
+	// tags follows the items of work: positive tags are the numbers
+	// before the batch, negative ones number the added items.
+	tags := make([]int, len(work))
+	for i := range tags {
+		tags[i] = i + 1
+	}
+	results := make([]batchResult, len(ops))
+	resultTags := make([]int, len(ops))
+	var events []event
+
+	fail := func(i int, err error) (todo.List, []batchResult, []event, error) {
+		for j := range results {
+			results[j] = batchResult{Op: ops[j].Op, ID: ops[j].ID, Status: batchSkipped}
+		}
+		results[i].Status = batchFailed
+		results[i].Error = err.Error()
+		return nil, results, nil, err
+	}
+
+	for i, op := range ops {
+		if (op.Op == batchAdd || op.Op == batchEdit) && lim.maxTaskLen > 0 &&
+			utf8.RuneCountInString(op.Task) > lim.maxTaskLen {
+			return fail(i, fmt.Errorf("%w: task longer than %d characters", ErrInvalidData, lim.maxTaskLen))
+		}
+		if (op.Op == batchAdd || op.Op == batchEdit) && op.Task == "" {
+			return fail(i, fmt.Errorf("%w: task is required", ErrInvalidData))
+		}
+
+		if op.Op == batchAdd {
+			if lim.maxItems > 0 && len(work) >= lim.maxItems {
+				return fail(i, fmt.Errorf("%s: %d items allowed", ErrListFull, lim.maxItems))
+			}
+			work.Add(op.Task)
+			tags = append(tags, -(i + 1))
+			resultTags[i] = -(i + 1)
+			events = append(events, event{Type: eventAdded, Position: len(work), Item: work[len(work)-1]})
+			continue
+		}
+
+		idx := slices.Index(tags, op.ID)
+		if op.ID < 1 || idx < 0 {
+			return fail(i, fmt.Errorf("%w: item %d", ErrNotFound, op.ID))
+		}
+		pos := idx + 1
+		switch op.Op {
+		case batchComplete:
+			before := work[idx]
+			work.Complete(pos)
+			events = append(events, event{Type: eventCompleted, Position: pos, Item: work[idx], Before: before})
+		case batchEdit:
+			before := work[idx]
+			work.Edit(pos, op.Task)
+			events = append(events, event{Type: eventEdited, Position: pos, Item: work[idx], Before: before})
+		case batchDelete:
+			events = append(events, event{Type: eventDeleted, Position: pos, Item: work[idx]})
+			if err := remove(&work, pos); err != nil {
+				return fail(i, err)
+			}
+			tags = slices.Delete(tags, idx, idx+1)
+			results[i] = batchResult{Op: op.Op, ID: op.ID, Status: batchApplied}
+			continue
+		default:
+			return fail(i, fmt.Errorf("%w: unknown operation %q", ErrInvalidData, op.Op))
+		}
+		resultTags[i] = op.ID
+	}
+
+	for i, op := range ops {
+		if op.Op == batchDelete {
+			continue
+		}
+		// Items changed and deleted later in the batch have no number.
+		results[i] = batchResult{Op: op.Op, ID: slices.Index(tags, resultTags[i]) + 1, Status: batchApplied}
+	}
+	return work, results, events, nil
+}
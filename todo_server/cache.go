@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notModified sets the validators of a GET in format from the store's
+// modification time and size and answers 304 Not Modified when the
+// client's copy is current. The caller holds the store lock. Clients
+// revalidate on every use, the list may change at any time.
+//
+// Last-Modified only has second precision, so the ETag, which carries
+// the full modification time, decides when the client sends both. The
+// size catches writes within the file system's timestamp granularity
+// that change the length of the list.
+func notModified(w http.ResponseWriter, r *http.Request, st *store, format string) bool {
+	mod, size := st.stat()
+	if mod.IsZero() {
+		return false
+	}
+	etag := `W/"` + strconv.FormatInt(mod.UnixNano(), 36) + "-" + strconv.FormatInt(size, 36) + "-" + format + `"`
+	h := w.Header()
+	h.Set("Cache-Control", "no-cache")
+	h.Set("ETag", etag)
+	h.Set("Last-Modified", mod.UTC().Format(http.TimeFormat))
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatch(inm, etag) {
+			return false
+		}
+	} else {
+		ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || mod.Truncate(time.Second).After(ims) {
+			return false
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch reports whether an If-None-Match list names etag, comparing
+// weakly.
+func etagMatch(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for tag := range strings.SplitSeq(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
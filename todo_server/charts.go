@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// Days the burndown chart covers unless ?days= says otherwise, and weeks
+// of the heatmap, the current one last.
+const (
+	burndownDays    = 30
+	burndownMaxDays = 365
+	heatmapWeeks    = 53
+)
+
+// heatmapColors go from no completion to the most completions in a day.
+var heatmapColors = []string{"#ebedf0", "#c6e48b", "#7bc96f", "#239a3b", "#196127"}
+
+// chartsHandler serves GET /todo/charts/{name}.svg: burndown, the open
+// items at the end of each day, and heatmap, the items completed each
+// day of the last year. Days are the server's.
+func chartsHandler(w http.ResponseWriter, r *http.Request, list *todo.List) {
+	if r.Method != http.MethodGet {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	now := time.Now()
+	var svg []byte
+	switch strings.TrimPrefix(r.URL.Path, "charts/") {
+	case "burndown.svg":
+		days := burndownDays
+		if v := r.URL.Query().Get("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 2 || n > burndownMaxDays {
+				message := fmt.Sprintf("%s: days must be 2 to %d", ErrInvalidData, burndownMaxDays)
+				replyErrorContent(w, r, http.StatusBadRequest, message)
+				return
+			}
+			days = n
+		}
+		svg = burndownSVG(list.OpenPerDay(now, days))
+	case "heatmap.svg":
+		// The first column starts on a Monday, the last ends today.
+		weekday := (int(now.Weekday()) + 6) % 7
+		svg = heatmapSVG(list.CompletedPerDay(now, (heatmapWeeks-1)*7+weekday+1))
+	default:
+		replyErrorContent(w, r, http.StatusNotFound, fmt.Sprintf("%s: chart %s", ErrNotFound, r.URL.Path))
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(svg)
+}
+
+// svgStart opens a standalone SVG document with a white background.
+func svgStart(b *bytes.Buffer, width, height int, title string) {
+	fmt.Fprintf(b, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11" fill="#24292e">
+<title>%s</title>
+<rect width="100%%" height="100%%" fill="#ffffff"/>
+<text x="10" y="18" font-size="13" font-weight="bold">%s</text>
+`, width, height, width, height, title, title)
+}
+
+// burndownSVG draws the open items of each day as a line over an area.
+func burndownSVG(days []todo.Period) []byte {
+	const (
+		width, height            = 640, 300
+		left, right, top, bottom = 44, 16, 32, 32
+		plotW, plotH             = width - left - right, height - top - bottom
+	)
+	maxCount := 0
+	for _, d := range days {
+		maxCount = max(maxCount, d.Count)
+	}
+	// Four gridlines on whole numbers.
+	yMax := max(4, (maxCount+3)/4*4)
+
+	x := func(i int) float64 {
+		return left + float64(i)*plotW/float64(len(days)-1)
+	}
+	y := func(c int) float64 {
+		return top + plotH - float64(c)*plotH/float64(yMax)
+	}
+
+	var b bytes.Buffer
+	svgStart(&b, width, height, fmt.Sprintf("Open items, last %d days", len(days)))
+	for k := 0; k <= 4; k++ {
+		v := yMax * k / 4
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#e1e4e8"/>`+"\n", left, y(v), width-right, y(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%d</text>`+"\n", left-6, y(v)+4, v)
+	}
+
+	var line strings.Builder
+	for i, d := range days {
+		fmt.Fprintf(&line, "%.1f,%.1f ", x(i), y(d.Count))
+	}
+	points := strings.TrimSpace(line.String())
+	fmt.Fprintf(&b, `<polygon points="%.1f,%.1f %s %.1f,%.1f" fill="#0366d6" fill-opacity="0.15"/>`+"\n",
+		x(0), y(0), points, x(len(days)-1), y(0))
+	fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#0366d6" stroke-width="2"/>`+"\n", points)
+	for i, d := range days {
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="#0366d6"><title>%s: %d open</title></circle>`+"\n",
+			x(i), y(d.Count), d.Start.Format("Jan 02"), d.Count)
+	}
+
+	for _, i := range []int{0, len(days) / 2, len(days) - 1} {
+		anchor := "middle"
+		switch i {
+		case 0:
+			anchor = "start"
+		case len(days) - 1:
+			anchor = "end"
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="%s">%s</text>`+"\n",
+			x(i), height-bottom+18, anchor, days[i].Start.Format("Jan 02"))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// heatmapSVG draws the completions of each day as a grid of weeks, one
+// row per weekday from Monday. days starts on a Monday.
+func heatmapSVG(days []todo.Period) []byte {
+	const (
+		cell, step = 11, 13
+		left, top  = 34, 44
+	)
+	weeks := (len(days) + 6) / 7
+	width, height := left+weeks*step+10, top+7*step+34
+
+	total, maxCount := 0, 0
+	for _, d := range days {
+		total += d.Count
+		maxCount = max(maxCount, d.Count)
+	}
+
+	var b bytes.Buffer
+	svgStart(&b, width, height, fmt.Sprintf("%d items completed in the last year", total))
+	for row, name := range []string{"Mon", "", "Wed", "", "Fri", "", ""} {
+		if name != "" {
+			fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`+"\n", left-6, top+row*step+cell-1, name)
+		}
+	}
+	for i, d := range days {
+		col, row := i/7, i%7
+		// Months are named above their first week, the first one only
+		// when it lasts long enough for its name to fit.
+		if row == 0 && col < weeks-2 && (col == 0 && d.Start.Month() == days[14].Start.Month() ||
+			col > 0 && d.Start.Month() != days[i-7].Start.Month()) {
+			fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`+"\n", left+col*step, top-8, d.Start.Format("Jan"))
+		}
+		level := 0
+		if d.Count > 0 {
+			level = min(4, (d.Count*4+maxCount-1)/maxCount)
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="2" fill="%s"><title>%s: %d completed</title></rect>`+"\n",
+			left+col*step, top+row*step, cell, cell, heatmapColors[level], d.Start.Format("Jan 02, 2006"), d.Count)
+	}
+
+	legendY := top + 7*step + 14
+	legendX := width - 10 - len(heatmapColors)*step - 30
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">Less</text>`+"\n", legendX-6, legendY+cell-1)
+	for i, c := range heatmapColors {
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="2" fill="%s"/>`+"\n", legendX+i*step, legendY, cell, cell, c)
+	}
+	fmt.Fprintf(&b, `<text x="%d" y="%d">More</text>`+"\n", legendX+len(heatmapColors)*step+4, legendY+cell-1)
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMinSize is the smallest response body worth compressing.
+const compressMinSize = 1024
+
+// Content codings the server compresses with, in order of preference
+// when the client accepts several equally.
+var compressEncodings = []string{"zstd", "gzip"}
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	zstdWriters = sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+)
+
+// encodingQuality returns the q value r's Accept-Encoding header gives
+// coding, from "*" when the coding is not listed.
+func encodingQuality(r *http.Request, coding string) float64 {
+	star := 0.0
+	for part := range strings.SplitSeq(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		v := 1.0
+		if k, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			var err error
+			if v, err = strconv.ParseFloat(strings.TrimSpace(val), 64); err != nil {
+				v = 0
+			}
+		}
+		switch name {
+		case coding:
+			return v
+		case "*":
+			star = v
+		}
+	}
+	return star
+}
+
+// acceptedEncoding picks the coding to compress r's response with, ""
+// when the client takes none of them.
+func acceptedEncoding(r *http.Request) string {
+	best, bestQ := "", 0.0
+	for _, coding := range compressEncodings {
+		if q := encodingQuality(r, coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compress encodes responses with zstd or gzip, as the request's
+// Accept-Encoding allows. Bodies shorter than compressMinSize, event
+// streams and responses that already carry a Content-Encoding are sent
+// as they are.
+func compress() middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			coding := acceptedEncoding(r)
+			if coding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, coding: coding}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter holds back the start of a body until it knows whether
+// the body is long enough to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	coding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		// Informational responses precede the final one.
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.passThrough()
+		return
+	}
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		cw.passThrough()
+		return
+	}
+	if mt, _, _ := mime.ParseMediaType(h.Get("Content-Type")); mt == "text/event-stream" {
+		cw.passThrough()
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= compressMinSize {
+		if err := cw.startEncoding(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// passThrough sends the response as the handler writes it.
+func (cw *compressWriter) passThrough() {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) > 0 {
+		cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+	}
+}
+
+// startEncoding sends the headers of a compressed response and what was
+// held back so far.
+func (cw *compressWriter) startEncoding() error {
+	cw.decided = true
+	h := cw.Header()
+	h.Set("Content-Encoding", cw.coding)
+	h.Del("Content-Length")
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		// The compressed bytes differ from the identity ones.
+		h.Set("ETag", "W/"+etag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	switch cw.coding {
+	case "zstd":
+		enc := zstdWriters.Get().(*zstd.Encoder)
+		enc.Reset(cw.ResponseWriter)
+		cw.enc = enc
+	default:
+		enc := gzipWriters.Get().(*gzip.Writer)
+		enc.Reset(cw.ResponseWriter)
+		cw.enc = enc
+	}
+	_, err := cw.enc.Write(cw.buf)
+	cw.buf = nil
+	return err
+}
+
+// FlushError sends what was written so far, compressing it when it is
+// long enough.
+func (cw *compressWriter) FlushError() error {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		if len(cw.buf) >= compressMinSize {
+			if err := cw.startEncoding(); err != nil {
+				return err
+			}
+		} else {
+			cw.passThrough()
+		}
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// close ends the body once the handler returned, and returns the
+// encoder to its pool.
+func (cw *compressWriter) close() {
+	if cw.status == 0 {
+		// The handler wrote nothing, net/http answers 200.
+		return
+	}
+	if !cw.decided {
+		cw.passThrough()
+		return
+	}
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Close()
+	switch enc := cw.enc.(type) {
+	case *zstd.Encoder:
+		enc.Reset(nil)
+		zstdWriters.Put(enc)
+	case *gzip.Writer:
+		enc.Reset(io.Discard)
+		gzipWriters.Put(enc)
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
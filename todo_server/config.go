@@ -0,0 +1,287 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// settings is the server configuration as read from flags, environment
+// and config file.
+type settings struct {
+	Listen struct {
+		Host string `mapstructure:"host" yaml:"host"`
+		Port int    `mapstructure:"port" yaml:"port"`
+	} `mapstructure:"listen" yaml:"listen"`
+	GRPC struct {
+		Port int `mapstructure:"port" yaml:"port"`
+	} `mapstructure:"grpc" yaml:"grpc"`
+	Storage struct {
+		Backend string `mapstructure:"backend" yaml:"backend"`
+		File    string `mapstructure:"file" yaml:"file"`
+		Dir     string `mapstructure:"dir" yaml:"dir"`
+	} `mapstructure:"storage" yaml:"storage"`
+	Timeouts struct {
+		Read     time.Duration `mapstructure:"read" yaml:"read"`
+		Write    time.Duration `mapstructure:"write" yaml:"write"`
+		Shutdown time.Duration `mapstructure:"shutdown" yaml:"shutdown"`
+	} `mapstructure:"timeouts" yaml:"timeouts"`
+	Log struct {
+		Level  string `mapstructure:"level" yaml:"level"`
+		Format string `mapstructure:"format" yaml:"format"`
+	} `mapstructure:"log" yaml:"log"`
+	Auth struct {
+		UsersFile string `mapstructure:"users_file" yaml:"users_file"`
+	} `mapstructure:"auth" yaml:"auth"`
+	Limits struct {
+		Rate       float64 `mapstructure:"rate" yaml:"rate"`
+		Burst      int     `mapstructure:"burst" yaml:"burst"`
+		MaxBody    int64   `mapstructure:"max_body" yaml:"max_body"`
+		MaxTaskLen int     `mapstructure:"max_task_len" yaml:"max_task_len"`
+		MaxItems   int     `mapstructure:"max_items" yaml:"max_items"`
+	} `mapstructure:"limits" yaml:"limits"`
+	TLS struct {
+		Cert       string `mapstructure:"cert" yaml:"cert"`
+		Key        string `mapstructure:"key" yaml:"key"`
+		SelfSigned bool   `mapstructure:"self_signed" yaml:"self_signed"`
+		ClientCA   string `mapstructure:"client_ca" yaml:"client_ca"`
+	} `mapstructure:"tls" yaml:"tls"`
+	CORS struct {
+		AllowedOrigins []string `mapstructure:"allowed_origins" yaml:"allowed_origins"`
+	} `mapstructure:"cors" yaml:"cors"`
+	Idempotency struct {
+		Window time.Duration `mapstructure:"window" yaml:"window"`
+	} `mapstructure:"idempotency" yaml:"idempotency"`
+	Audit struct {
+		File string `mapstructure:"file" yaml:"file"`
+	} `mapstructure:"audit" yaml:"audit"`
+	Trash struct {
+		PurgeDays int `mapstructure:"purge_days" yaml:"purge_days"`
+	} `mapstructure:"trash" yaml:"trash"`
+	Report struct {
+		Templates string `mapstructure:"templates" yaml:"templates"`
+	} `mapstructure:"report" yaml:"report"`
+	Webhooks struct {
+		File        string          `mapstructure:"file" yaml:"file"`
+		MaxAttempts int             `mapstructure:"max_attempts" yaml:"max_attempts"`
+		Backoff     time.Duration   `mapstructure:"backoff" yaml:"backoff"`
+		Timeout     time.Duration   `mapstructure:"timeout" yaml:"timeout"`
+		Endpoints   []endpointEntry `mapstructure:"endpoints" yaml:"endpoints"`
+	} `mapstructure:"webhooks" yaml:"webhooks"`
+}
+
+// endpointEntry is a webhook defined in the config file. Events lists
+// the event types to send, all of them when empty.
+type endpointEntry struct {
+	URL    string   `mapstructure:"url" yaml:"url"`
+	Secret string   `mapstructure:"secret" yaml:"secret"`
+	Events []string `mapstructure:"events" yaml:"events"`
+}
+
+// option is a config key with its default and, optionally, the command
+// line flag that overrides it.
+type option struct {
+	key   string
+	flag  string
+	value any
+	usage string
+}
+
+var options = []option{
+	{"listen.host", "h", "localhost", "Server host"},
+	{"listen.port", "p", 8080, "Server port"},
+	{"grpc.port", "grpc-port", 0, "Port of the gRPC API on the server host, 0 disables"},
+	{"storage.backend", "storage", "file", "Storage backend, only file is supported"},
+	{"storage.file", "f", "todo_server.json", "File name to store"},
+	{"storage.dir", "d", ".", "Directory for per-user list files"},
+	{"timeouts.read", "read-timeout", 10 * time.Second, "Maximum time to read a request"},
+	{"timeouts.write", "write-timeout", 10 * time.Second, "Maximum time to write a response"},
+	{"timeouts.shutdown", "shutdown-timeout", 15 * time.Second, "Time to let in-flight requests finish on shutdown"},
+	{"log.level", "log-level", "info", "Log level: debug, info, warn or error"},
+	{"log.format", "log-format", "text", "Log format: text or json"},
+	{"auth.users_file", "users", "", "JSON file with users and tokens, enables per-user lists"},
+	{"limits.rate", "rate", 0.0, "Requests per second allowed per client, 0 disables"},
+	{"limits.burst", "burst", 20, "Requests a client may burst above the rate"},
+	{"limits.max_body", "max-body", int64(1 << 20), "Maximum request body size in bytes, 0 disables"},
+	{"limits.max_task_len", "max-task-len", 1000, "Maximum task length in characters, 0 disables"},
+	{"limits.max_items", "max-items", 10000, "Maximum items per list, 0 disables"},
+	{"tls.cert", "tls-cert", "", "TLS certificate file, enables HTTPS"},
+	{"tls.key", "tls-key", "", "TLS private key file"},
+	{"tls.self_signed", "tls-self-signed", false, "Serve HTTPS with a generated self-signed certificate (development only)"},
+	{"tls.client_ca", "tls-client-ca", "", "CA bundle to verify client certificates against, enables mutual TLS"},
+	{"cors.allowed_origins", "cors-origins", []string{}, "Comma separated origins allowed to call the API from a browser, * for any"},
+	{"idempotency.window", "idempotency-window", 24 * time.Hour, "How long Idempotency-Key responses are kept, 0 disables"},
+	{"audit.file", "audit-file", "", "Hash-chained log of every change to the lists, empty disables"},
+	{"trash.purge_days", "trash-days", 30, "Days deleted items stay in the trash, 0 keeps them until restored"},
+	{"report.templates", "report-templates", "", "Directory with report.md.tmpl and report.html.tmpl replacing the built-in report templates"},
+	{"webhooks.file", "webhooks-file", "webhooks_queue.json", "File keeping registered webhooks and the delivery queue"},
+	{"webhooks.max_attempts", "webhook-attempts", 8, "Delivery attempts before a webhook delivery fails"},
+	{"webhooks.backoff", "webhook-backoff", time.Second, "Delay before the first webhook retry, doubled on every retry"},
+	{"webhooks.timeout", "webhook-timeout", 10 * time.Second, "Maximum time to wait for a webhook receiver"},
+}
+
+// defineFlags registers a flag for every option that has one.
+func defineFlags(fs *flag.FlagSet) {
+	for _, o := range options {
+		if o.flag == "" {
+			continue
+		}
+		switch v := o.value.(type) {
+		case string:
+			fs.String(o.flag, v, o.usage)
+		case int:
+			fs.Int(o.flag, v, o.usage)
+		case int64:
+			fs.Int64(o.flag, v, o.usage)
+		case float64:
+			fs.Float64(o.flag, v, o.usage)
+		case bool:
+			fs.Bool(o.flag, v, o.usage)
+		case time.Duration:
+			fs.Duration(o.flag, v, o.usage)
+		case []string:
+			fs.String(o.flag, strings.Join(v, ","), o.usage)
+		default:
+			panic(fmt.Sprintf("unsupported option type %T for %s", v, o.key))
+		}
+	}
+}
+
+// loadSettings merges the sources in order of precedence: flags set on
+// the command line, TODO_SERVER_* environment variables, the config file
+// and the defaults.
+func loadSettings(fs *flag.FlagSet, configFile string) (settings, error) {
+	v := viper.New()
+	for _, o := range options {
+		v.SetDefault(o.key, o.value)
+	}
+
+	v.SetEnvPrefix("TODO_SERVER")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			return settings{}, err
+		}
+	}
+
+	flagKeys := map[string]string{}
+	for _, o := range options {
+		flagKeys[o.flag] = o.key
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			v.Set(key, f.Value.String())
+		}
+	})
+
+	var s settings
+	if err := v.Unmarshal(&s); err != nil {
+		return settings{}, err
+	}
+	if s.Storage.Backend != "file" {
+		return settings{}, fmt.Errorf("%w: storage backend %q", ErrInvalidData, s.Storage.Backend)
+	}
+	return s, nil
+}
+
+// redacted replaces secrets in printed settings.
+const redacted = "REDACTED"
+
+// printSettings writes s as YAML, with webhook secrets redacted.
+func printSettings(w io.Writer, s settings) error {
+	endpoints := slices.Clone(s.Webhooks.Endpoints)
+	for i := range endpoints {
+		if endpoints[i].Secret != "" {
+			endpoints[i].Secret = redacted
+		}
+	}
+	s.Webhooks.Endpoints = endpoints
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// newConfig turns settings into the handler configuration, loading the
+// users file it points to.
+func newConfig(s settings, logger *slog.Logger) (config, error) {
+	cfg := config{
+		todoFile:          s.Storage.File,
+		dataDir:           s.Storage.Dir,
+		rateLimit:         s.Limits.Rate,
+		rateBurst:         s.Limits.Burst,
+		maxBody:           s.Limits.MaxBody,
+		idempotencyWindow: s.Idempotency.Window,
+		corsOrigins:       s.CORS.AllowedOrigins,
+		trashDays:         s.Trash.PurgeDays,
+		limits: limits{
+			maxTaskLen: s.Limits.MaxTaskLen,
+			maxItems:   s.Limits.MaxItems,
+		},
+		logger: logger,
+	}
+	if s.Auth.UsersFile != "" {
+		users, err := loadUsers(s.Auth.UsersFile)
+		if err != nil {
+			return config{}, err
+		}
+		cfg.users = users
+	}
+	reports, err := loadReportTemplates(s.Report.Templates)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.reports = reports
+	if s.Audit.File != "" {
+		audit, err := openAuditLog(s.Audit.File)
+		if err != nil {
+			return config{}, err
+		}
+		cfg.audit = audit
+	}
+
+	hooks := webhookOptions{
+		file:        s.Webhooks.File,
+		maxAttempts: s.Webhooks.MaxAttempts,
+		backoff:     s.Webhooks.Backoff,
+		timeout:     s.Webhooks.Timeout,
+	}
+	for _, e := range s.Webhooks.Endpoints {
+		hooks.endpoints = append(hooks.endpoints, webhook{URL: e.URL, Secret: e.Secret, Events: e.Events})
+	}
+	// Without users and configured webhooks there is nothing to send:
+	// none can be registered, unless a queue file holds some already.
+	if cfg.users == nil && len(hooks.endpoints) == 0 {
+		if _, err := os.Stat(hooks.file); hooks.file == "" || err != nil {
+			return cfg, nil
+		}
+	}
+	wh, err := newWebhooks(hooks, logger)
+	if err != nil {
+		return config{}, err
+	}
+	cfg.webhooks = wh
+	return cfg, nil
+}
+
+func (s settings) tlsOptions() tlsOptions {
+	return tlsOptions{
+		certFile:   s.TLS.Cert,
+		keyFile:    s.TLS.Key,
+		selfSigned: s.TLS.SelfSigned,
+		clientCA:   s.TLS.ClientCA,
+	}
+}
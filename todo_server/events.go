@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Event types sent on the change stream.
+const (
+	eventAdded        = "item.added"
+	eventCompleted    = "item.completed"
+	eventDeleted      = "item.deleted"
+	eventEdited       = "item.edited"
+	eventReordered    = "item.reordered"
+	eventRestored     = "item.restored"
+	eventTimerStarted = "timer.started"
+	eventTimerStopped = "timer.stopped"
+	eventReset        = "stream.reset"
+)
+
+const (
+	eventBufferSize   = 1000
+	eventHeartbeat    = 15 * time.Second
+	eventSubscriberCh = 64
+)
+
+// event is one change to a list. Position is the item number the change
+// applies to, To the new number of a reordered item. Before is the item
+// as it was before a completion or edit, kept for the audit log only.
+type event struct {
+	ID       uint64    `json:"id"`
+	Type     string    `json:"type"`
+	Position int       `json:"position,omitempty"`
+	To       int       `json:"to,omitempty"`
+	Item     any       `json:"item,omitempty"`
+	Before   any       `json:"-"`
+	Time     time.Time `json:"time"`
+}
+
+// eventItem holds the fields of an event's item.
+type eventItem struct {
+	Task        string
+	Done        bool
+	CreatedAt   time.Time
+	CompletedAt time.Time
+}
+
+// item returns the item of e. Events hold a copy of a list item, which
+// is read back through its JSON form as the item type is not exported.
+func (e event) item() (eventItem, bool) {
+	var it eventItem
+	if e.Item == nil {
+		return it, false
+	}
+	data, err := json.Marshal(e.Item)
+	if err != nil {
+		return it, false
+	}
+	return it, json.Unmarshal(data, &it) == nil
+}
+
+// itemID is the item number after the change.
+func (e event) itemID() int {
+	if e.Type == eventReordered {
+		return e.To
+	}
+	return e.Position
+}
+
+// eventLog keeps the most recent events of a list and fans new ones out
+// to subscribers. IDs start from the clock at creation, so they keep
+// growing across restarts and a stale Last-Event-ID is detected.
+type eventLog struct {
+	mu     sync.Mutex
+	nextID uint64
+	buf    []event
+	size   int
+	subs   map[chan event]struct{}
+	closed bool
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{
+		nextID: uint64(time.Now().UnixMicro()),
+		size:   size,
+		subs:   map[chan event]struct{}{},
+	}
+}
+
+// publish stamps e with the next ID and sends it to the subscribers.
+func (el *eventLog) publish(e event) event {
+	if el == nil {
+		return e
+	}
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	el.nextID++
+	e.ID = el.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	el.buf = append(el.buf, e)
+	if len(el.buf) > el.size {
+		el.buf = el.buf[len(el.buf)-el.size:]
+	}
+	for ch := range el.subs {
+		select {
+		case ch <- e:
+		default:
+			// A subscriber that cannot keep up is dropped and will
+			// resume from its last event when it reconnects.
+			delete(el.subs, ch)
+			close(ch)
+		}
+	}
+	return e
+}
+
+// subscribe returns the buffered events after lastID and a channel for
+// new ones. reset is true when events after lastID are no longer
+// buffered and the client has to reload the list.
+func (el *eventLog) subscribe(lastID uint64, resume bool) (backlog []event, ch chan event, reset bool) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	ch = make(chan event, eventSubscriberCh)
+	if el.closed {
+		close(ch)
+		return nil, ch, false
+	}
+	el.subs[ch] = struct{}{}
+	if !resume {
+		return nil, ch, false
+	}
+
+	if lastID > el.nextID {
+		return nil, ch, true
+	}
+	oldest := el.nextID + 1
+	if len(el.buf) > 0 {
+		oldest = el.buf[0].ID
+	}
+	if lastID+1 < oldest {
+		reset = true
+	}
+	for _, e := range el.buf {
+		if e.ID > lastID {
+			backlog = append(backlog, e)
+		}
+	}
+	return backlog, ch, reset
+}
+
+func (el *eventLog) unsubscribe(ch chan event) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if _, ok := el.subs[ch]; ok {
+		delete(el.subs, ch)
+		close(ch)
+	}
+}
+
+// close ends every stream, used on shutdown.
+func (el *eventLog) close() {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.closed = true
+	for ch := range el.subs {
+		delete(el.subs, ch)
+		close(ch)
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// eventsHandler streams the changes of the caller's list as Server-Sent
+// Events, starting after the Last-Event-ID the client sends.
+func eventsHandler(w http.ResponseWriter, r *http.Request, st *store) {
+	if r.Method != http.MethodGet {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	var lastID uint64
+	last := r.Header.Get("Last-Event-ID")
+	resume := last != ""
+	if resume {
+		id, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("%s: Last-Event-ID", ErrInvalidData))
+			return
+		}
+		lastID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server write timeout.
+	rc.SetWriteDeadline(time.Time{})
+
+	backlog, ch, reset := st.events.subscribe(lastID, resume)
+	defer st.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 2000\n\n")
+
+	if reset {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+	}
+	for _, e := range backlog {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
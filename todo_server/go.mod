@@ -2,6 +2,30 @@ module pragprog.com/rggo/apis/todo_server
 
 go 1.25.4
 
-require pragprog.com/rggo/interacting/todo v0.0.0
+require (
+	github.com/graph-gophers/graphql-go v1.9.0
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/viper v1.21.0
+	go.yaml.in/yaml/v3 v3.0.4
+	google.golang.org/grpc v1.76.0
+	google.golang.org/protobuf v1.36.10
+	pragprog.com/rggo/interacting/todo v0.0.0
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	github.com/go-viper/mapstructure/v2 v2.4.0 // indirect
+	github.com/pelletier/go-toml/v2 v2.2.4 // indirect
+	github.com/sagikazarmark/locafero v0.11.0 // indirect
+	github.com/sourcegraph/conc v0.3.1-0.20240121214520-5f936abd7ae8 // indirect
+	github.com/spf13/afero v1.15.0 // indirect
+	github.com/spf13/cast v1.10.0 // indirect
+	github.com/spf13/pflag v1.0.10 // indirect
+	github.com/subosito/gotenv v1.6.0 // indirect
+	golang.org/x/net v0.42.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250804133106-a7a43d27e69b // indirect
+)
 
 replace pragprog.com/rggo/interacting/todo => ../todo
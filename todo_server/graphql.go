@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+//go:embed schema.graphql
+var graphqlSchema string
+
+const (
+	// graphqlMaxPage caps the items returned by one items query.
+	graphqlMaxPage  = 1000
+	graphqlMaxDepth = 10
+)
+
+// newGraphQLSchema returns the executable schema for the lists of
+// stores. Resolvers take the same store locks as todoRouter.
+func newGraphQLSchema(stores *storeSet, lim limits) *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, &graphqlResolver{stores: stores, lim: lim},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(graphqlMaxDepth),
+	)
+}
+
+// graphqlResolver resolves the Query, Mutation and Subscription fields.
+type graphqlResolver struct {
+	stores *storeSet
+	lim    limits
+}
+
+type itemResolver struct {
+	id int
+	it eventItem
+}
+
+func newItemResolver(list *todo.List, id int) *itemResolver {
+	it := (*list)[id-1]
+	return &itemResolver{id: id, it: eventItem{
+		Task:        it.Task,
+		Done:        it.Done,
+		CreatedAt:   it.CreatedAt,
+		CompletedAt: it.CompletedAt,
+	}}
+}
+
+func (r *itemResolver) ID() int32 {
+	return int32(r.id)
+}
+
+func (r *itemResolver) Task() string {
+	return r.it.Task
+}
+
+func (r *itemResolver) Done() bool {
+	return r.it.Done
+}
+
+func (r *itemResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.it.CreatedAt}
+}
+
+func (r *itemResolver) CompletedAt() *graphql.Time {
+	if r.it.CompletedAt.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: r.it.CompletedAt}
+}
+
+type itemFilter struct {
+	Status        string
+	Contains      *string
+	CreatedAfter  *graphql.Time
+	CreatedBefore *graphql.Time
+}
+
+func (f *itemFilter) match(it *itemResolver) bool {
+	if f == nil {
+		return true
+	}
+	switch f.Status {
+	case "PENDING":
+		if it.it.Done {
+			return false
+		}
+	case "DONE":
+		if !it.it.Done {
+			return false
+		}
+	}
+	if f.Contains != nil && !strings.Contains(strings.ToLower(it.it.Task), strings.ToLower(*f.Contains)) {
+		return false
+	}
+	if f.CreatedAfter != nil && !it.it.CreatedAt.After(f.CreatedAfter.Time) {
+		return false
+	}
+	if f.CreatedBefore != nil && !it.it.CreatedAt.Before(f.CreatedBefore.Time) {
+		return false
+	}
+	return true
+}
+
+type itemPageResolver struct {
+	items       []*itemResolver
+	total       int
+	hasNextPage bool
+}
+
+func (r *itemPageResolver) Items() []*itemResolver {
+	return r.items
+}
+
+func (r *itemPageResolver) TotalCount() int32 {
+	return int32(r.total)
+}
+
+func (r *itemPageResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+type countsResolver struct {
+	total, done int
+}
+
+func (r *countsResolver) Total() int32 {
+	return int32(r.total)
+}
+
+func (r *countsResolver) Pending() int32 {
+	return int32(r.total - r.done)
+}
+
+func (r *countsResolver) Done() int32 {
+	return int32(r.done)
+}
+
+// read runs fn on the caller's list under its store lock.
+func (r *graphqlResolver) read(ctx context.Context, fn func(list *todo.List) error) error {
+	return r.stores.forContext(ctx).update(ctx, func(list *todo.List) ([]event, error) {
+		return nil, fn(list)
+	})
+}
+
+func (r *graphqlResolver) update(ctx context.Context, fn func(list *todo.List) ([]event, error)) error {
+	return r.stores.forContext(ctx).update(ctx, fn)
+}
+
+func (r *graphqlResolver) checkTask(task string) error {
+	if task == "" {
+		return fmt.Errorf("%w: task is required", ErrInvalidData)
+	}
+	if r.lim.maxTaskLen > 0 && utf8.RuneCountInString(task) > r.lim.maxTaskLen {
+		return fmt.Errorf("%w: task longer than %d characters", ErrInvalidData, r.lim.maxTaskLen)
+	}
+	return nil
+}
+
+func checkItem(list *todo.List, id int32) error {
+	if id < 1 || int(id) > len(*list) {
+		return fmt.Errorf("%w: item %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (r *graphqlResolver) Items(ctx context.Context, args struct {
+	Filter *itemFilter
+	Sort   string
+	Order  string
+	First  int32
+	Offset int32
+}) (*itemPageResolver, error) {
+	first, offset := int(args.First), int(args.Offset)
+	if first < 0 || offset < 0 {
+		return nil, fmt.Errorf("%w: first and offset must not be negative", ErrInvalidData)
+	}
+	first = min(first, graphqlMaxPage)
+
+	var items []*itemResolver
+	err := r.read(ctx, func(list *todo.List) error {
+		for i := range *list {
+			if it := newItemResolver(list, i+1); args.Filter.match(it) {
+				items = append(items, it)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var cmp func(a, b *itemResolver) int
+	switch args.Sort {
+	case "TASK":
+		cmp = func(a, b *itemResolver) int { return strings.Compare(a.it.Task, b.it.Task) }
+	case "CREATED_AT":
+		cmp = func(a, b *itemResolver) int { return a.it.CreatedAt.Compare(b.it.CreatedAt) }
+	case "COMPLETED_AT":
+		cmp = func(a, b *itemResolver) int { return a.it.CompletedAt.Compare(b.it.CompletedAt) }
+	default:
+		cmp = func(a, b *itemResolver) int { return a.id - b.id }
+	}
+	if args.Order == "DESC" {
+		asc := cmp
+		cmp = func(a, b *itemResolver) int { return asc(b, a) }
+	}
+	slices.SortStableFunc(items, cmp)
+
+	page := &itemPageResolver{total: len(items)}
+	if offset < len(items) {
+		end := min(offset+first, len(items))
+		page.items = items[offset:end]
+		page.hasNextPage = end < len(items)
+	}
+	if page.items == nil {
+		page.items = []*itemResolver{}
+	}
+	return page, nil
+}
+
+func (r *graphqlResolver) Item(ctx context.Context, args struct{ ID int32 }) (*itemResolver, error) {
+	var item *itemResolver
+	err := r.read(ctx, func(list *todo.List) error {
+		if checkItem(list, args.ID) == nil {
+			item = newItemResolver(list, int(args.ID))
+		}
+		return nil
+	})
+	return item, err
+}
+
+func (r *graphqlResolver) Counts(ctx context.Context) (*countsResolver, error) {
+	c := &countsResolver{}
+	err := r.read(ctx, func(list *todo.List) error {
+		c.total = len(*list)
+		for _, it := range *list {
+			if it.Done {
+				c.done++
+			}
+		}
+		return nil
+	})
+	return c, err
+}
+
+func (r *graphqlResolver) AddItem(ctx context.Context, args struct{ Task string }) (*itemResolver, error) {
+	if err := r.checkTask(args.Task); err != nil {
+		return nil, err
+	}
+	var item *itemResolver
+	err := r.update(ctx, func(list *todo.List) ([]event, error) {
+		if r.lim.maxItems > 0 && len(*list) >= r.lim.maxItems {
+			return nil, fmt.Errorf("%s: %d items allowed", ErrListFull, r.lim.maxItems)
+		}
+		list.Add(args.Task)
+		id := len(*list)
+		item = newItemResolver(list, id)
+		return []event{{Type: eventAdded, Position: id, Item: (*list)[id-1]}}, nil
+	})
+	return item, err
+}
+
+func (r *graphqlResolver) CompleteItem(ctx context.Context, args struct{ ID int32 }) (*itemResolver, error) {
+	var item *itemResolver
+	err := r.update(ctx, func(list *todo.List) ([]event, error) {
+		if err := checkItem(list, args.ID); err != nil {
+			return nil, err
+		}
+		id := int(args.ID)
+		before := (*list)[id-1]
+		if err := list.Complete(id); err != nil {
+			return nil, err
+		}
+		item = newItemResolver(list, id)
+		return []event{{Type: eventCompleted, Position: id, Item: (*list)[id-1], Before: before}}, nil
+	})
+	return item, err
+}
+
+func (r *graphqlResolver) DeleteItem(ctx context.Context, args struct{ ID int32 }) (*itemResolver, error) {
+	var item *itemResolver
+	st := r.stores.forContext(ctx)
+	err := st.update(ctx, func(list *todo.List) ([]event, error) {
+		if err := checkItem(list, args.ID); err != nil {
+			return nil, err
+		}
+		id := int(args.ID)
+		item = newItemResolver(list, id)
+		deleted := (*list)[id-1]
+		if err := st.remove(list, id); err != nil {
+			return nil, err
+		}
+		return []event{{Type: eventDeleted, Position: id, Item: deleted}}, nil
+	})
+	return item, err
+}
+
+func (r *graphqlResolver) EditItem(ctx context.Context, args struct {
+	ID   int32
+	Task string
+}) (*itemResolver, error) {
+	if err := r.checkTask(args.Task); err != nil {
+		return nil, err
+	}
+	var item *itemResolver
+	err := r.update(ctx, func(list *todo.List) ([]event, error) {
+		if err := checkItem(list, args.ID); err != nil {
+			return nil, err
+		}
+		id := int(args.ID)
+		before := (*list)[id-1]
+		if err := list.Edit(id, args.Task); err != nil {
+			return nil, err
+		}
+		item = newItemResolver(list, id)
+		return []event{{Type: eventEdited, Position: id, Item: (*list)[id-1], Before: before}}, nil
+	})
+	return item, err
+}
+
+type eventResolver struct {
+	e event
+}
+
+func (r *eventResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(r.e.ID, 10))
+}
+
+func (r *eventResolver) Type() string {
+	return r.e.Type
+}
+
+func optionalInt(n int) *int32 {
+	if n == 0 {
+		return nil
+	}
+	v := int32(n)
+	return &v
+}
+
+func (r *eventResolver) Position() *int32 {
+	return optionalInt(r.e.Position)
+}
+
+func (r *eventResolver) To() *int32 {
+	return optionalInt(r.e.To)
+}
+
+func (r *eventResolver) Item() *itemResolver {
+	it, ok := r.e.item()
+	if !ok {
+		return nil
+	}
+	return &itemResolver{id: r.e.itemID(), it: it}
+}
+
+func (r *eventResolver) Time() graphql.Time {
+	return graphql.Time{Time: r.e.Time}
+}
+
+// Changes streams the events of the caller's list until the client goes
+// away. The stream ends on shutdown or when the client falls behind, and
+// a client resuming with after gets a stream.reset event when changes
+// were missed.
+func (r *graphqlResolver) Changes(ctx context.Context, args struct{ After *graphql.ID }) (<-chan *eventResolver, error) {
+	var lastID uint64
+	if args.After != nil {
+		id, err := strconv.ParseUint(string(*args.After), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: after", ErrInvalidData)
+		}
+		lastID = id
+	}
+	st := r.stores.forContext(ctx)
+	backlog, ch, reset := st.events.subscribe(lastID, args.After != nil)
+
+	out := make(chan *eventResolver)
+	go func() {
+		defer close(out)
+		defer st.events.unsubscribe(ch)
+
+		send := func(e event) bool {
+			select {
+			case out <- &eventResolver{e: e}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if reset && !send(event{Type: eventReset, Time: time.Now()}) {
+			return
+		}
+		for _, e := range backlog {
+			if !send(e) {
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-ch:
+				if !ok || !send(e) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlHandler executes POSTed GraphQL requests. Clients that prefer
+// text/event-stream get the results as Server-Sent Events, which is how
+// subscriptions are served: one "next" event per result and "complete"
+// when the operation ends.
+func graphqlHandler(schema *graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+			return
+		}
+		var req graphqlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				replyErrorContent(w, r, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %s", err))
+			return
+		}
+		if acceptQuality(r, "text/event-stream") > acceptQuality(r, "application/json") {
+			graphqlStream(w, r, schema, req)
+			return
+		}
+		replyJSON(w, r, http.StatusOK, schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables))
+	}
+}
+
+func graphqlStream(w http.ResponseWriter, r *http.Request, schema *graphql.Schema, req graphqlRequest) {
+	results, err := schema.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server write timeout.
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case res, ok := <-results:
+			if !ok {
+				fmt.Fprint(w, "event: complete\ndata:\n\n")
+				rc.Flush()
+				return
+			}
+			data, err := json.Marshal(res)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: next\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGraphQL(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	query := func(t *testing.T, q string, vars map[string]any) (json.RawMessage, []string) {
+		t.Helper()
+		body, err := json.Marshal(graphqlRequest{Query: q, Variables: vars})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := http.Post(url+"/graphql", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %q, got %q", http.StatusText(http.StatusOK), http.StatusText(r.StatusCode))
+		}
+		var resp struct {
+			Data   json.RawMessage `json:"data"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		var errs []string
+		for _, e := range resp.Errors {
+			errs = append(errs, e.Message)
+		}
+		return resp.Data, errs
+	}
+
+	t.Run("Mutations", func(t *testing.T) {
+		data, errs := query(t, `mutation($task: String!) {
+			added: addItem(task: $task) { id task done }
+			completed: completeItem(id: 1) { id done completedAt }
+			edited: editItem(id: 2, task: "Edited task 2") { task }
+		}`, map[string]any{"task": "GraphQL task"})
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		exp := `{"added":{"id":3,"task":"GraphQL task","done":false},"completed":{"id":1,"done":true,"completedAt":`
+		if !strings.HasPrefix(string(data), exp) || !strings.Contains(string(data), `"edited":{"task":"Edited task 2"}`) {
+			t.Errorf("Unexpected data %s", data)
+		}
+
+		_, errs = query(t, `mutation { deleteItem(id: 9) { id } }`, nil)
+		if len(errs) != 1 || !strings.Contains(errs[0], "Not Found") {
+			t.Errorf("Expected not found error, got %v", errs)
+		}
+	})
+
+	testCases := []struct {
+		name  string
+		query string
+		exp   string
+	}{
+		{name: "Pending", query: `{ items(filter: {status: PENDING}) { totalCount items { id } } }`,
+			exp: `{"items":{"totalCount":2,"items":[{"id":2},{"id":3}]}}`},
+		{name: "Contains", query: `{ items(filter: {contains: "graphql"}) { items { task } } }`,
+			exp: `{"items":{"items":[{"task":"GraphQL task"}]}}`},
+		{name: "Sort", query: `{ items(sort: TASK, order: DESC) { items { id } } }`,
+			exp: `{"items":{"items":[{"id":1},{"id":3},{"id":2}]}}`},
+		{name: "Page", query: `{ items(first: 1, offset: 1) { totalCount hasNextPage items { id } } }`,
+			exp: `{"items":{"totalCount":3,"hasNextPage":true,"items":[{"id":2}]}}`},
+		{name: "Item and counts", query: `{ item(id: 1) { task } missing: item(id: 7) { task } counts { total pending done } }`,
+			exp: `{"item":{"task":"Test task 1"},"missing":null,"counts":{"total":3,"pending":2,"done":1}}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, errs := query(t, tc.query, nil)
+			if len(errs) != 0 {
+				t.Fatal(errs)
+			}
+			if string(data) != tc.exp {
+				t.Errorf("Expected %s, got %s", tc.exp, data)
+			}
+		})
+	}
+
+	t.Run("Invalid query", func(t *testing.T) {
+		if _, errs := query(t, `{ items { priority } }`, nil); len(errs) == 0 {
+			t.Error("Expected an error for an unknown field")
+		}
+	})
+
+	t.Run("Subscription", func(t *testing.T) {
+		body := `{"query":"subscription { changes { type position item { task } } }"}`
+		req, err := http.NewRequest(http.MethodPost, url+"/graphql", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "text/event-stream")
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		if ct := r.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Expected event stream, got %q", ct)
+		}
+
+		// The headers are sent once the subscription is set up.
+		query(t, `mutation { addItem(task: "Streamed") { id } }`, nil)
+
+		s := bufio.NewScanner(r.Body)
+		var lines []string
+		for s.Scan() && s.Text() != "" {
+			lines = append(lines, s.Text())
+		}
+		exp := []string{
+			"event: next",
+			`data: {"data":{"changes":{"type":"item.added","position":4,"item":{"task":"Streamed"}}}}`,
+		}
+		if strings.Join(lines, "\n") != strings.Join(exp, "\n") {
+			t.Errorf("Expected %q, got %q", exp, lines)
+		}
+	})
+}
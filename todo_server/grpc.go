@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"pragprog.com/rggo/apis/todo_server/todopb"
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// todoService serves the gRPC API from the same stores, and under the
+// same store locks, as todoRouter, so both APIs see the same lists and
+// change stream.
+type todoService struct {
+	todopb.UnimplementedTodoServer
+	stores *storeSet
+	lim    limits
+}
+
+// newGRPCServer returns a gRPC server for a's lists. With users it
+// authenticates calls like the REST API, with tlsCfg it serves TLS.
+func newGRPCServer(a *app, tlsCfg *tls.Config) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	if a.cfg.users != nil {
+		opts = append(opts,
+			grpc.UnaryInterceptor(grpcAuthUnary(a.cfg.users)),
+			grpc.StreamInterceptor(grpcAuthStream(a.cfg.users)),
+		)
+	}
+	s := grpc.NewServer(opts...)
+	todopb.RegisterTodoServer(s, &todoService{stores: a.stores, lim: a.cfg.limits})
+	return s
+}
+
+// stopGRPC waits for calls to finish until ctx is done, then closes the
+// remaining ones.
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
+// grpcUser adds the user of the call's bearer token to ctx.
+func grpcUser(ctx context.Context, users userList) (context.Context, error) {
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) > 0 {
+		token, _ = strings.CutPrefix(v[0], "Bearer ")
+	}
+	u, ok := users.byToken(strings.TrimSpace(token))
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, ErrUnauthorized.Error())
+	}
+	return context.WithValue(ctx, userKey{}, u), nil
+}
+
+func grpcAuthUnary(users userList) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := grpcUser(ctx, users)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// userStream carries the authenticated context to stream handlers.
+type userStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s userStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcAuthStream(users userList) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := grpcUser(ss.Context(), users)
+		if err != nil {
+			return err
+		}
+		return handler(srv, userStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// update runs fn on the caller's list, see store.update. Storage errors
+// are reported as Internal.
+func (s *todoService) update(ctx context.Context, fn func(list *todo.List) ([]event, error)) error {
+	if p, ok := peer.FromContext(ctx); ok {
+		ctx = context.WithValue(ctx, remoteAddrKey{}, p.Addr.String())
+	}
+	err := s.stores.forContext(ctx).update(ctx, fn)
+	if _, ok := status.FromError(err); !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return err
+}
+
+func checkID(list *todo.List, id int32) error {
+	if id < 1 || int(id) > len(*list) {
+		return status.Error(codes.NotFound, fmt.Sprintf("%s: item %d", ErrNotFound, id))
+	}
+	return nil
+}
+
+func (s *todoService) checkTask(task string) error {
+	if task == "" {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("%s: task is required", ErrInvalidData))
+	}
+	if s.lim.maxTaskLen > 0 && utf8.RuneCountInString(task) > s.lim.maxTaskLen {
+		return status.Error(codes.InvalidArgument,
+			fmt.Sprintf("%s: task longer than %d characters", ErrInvalidData, s.lim.maxTaskLen))
+	}
+	return nil
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// itemMessage returns item id of list.
+func itemMessage(list *todo.List, id int) *todopb.Item {
+	it := (*list)[id-1]
+	return &todopb.Item{
+		Id:          int32(id),
+		Task:        it.Task,
+		Done:        it.Done,
+		CreatedAt:   timestamp(it.CreatedAt),
+		CompletedAt: timestamp(it.CompletedAt),
+	}
+}
+
+func eventMessage(e event) *todopb.Event {
+	msg := &todopb.Event{
+		Id:       e.ID,
+		Type:     e.Type,
+		Position: int32(e.Position),
+		To:       int32(e.To),
+		Time:     timestamp(e.Time),
+	}
+	if it, ok := e.item(); ok {
+		msg.Item = &todopb.Item{
+			Id:          int32(e.itemID()),
+			Task:        it.Task,
+			Done:        it.Done,
+			CreatedAt:   timestamp(it.CreatedAt),
+			CompletedAt: timestamp(it.CompletedAt),
+		}
+	}
+	return msg
+}
+
+func (s *todoService) List(ctx context.Context, _ *todopb.ListRequest) (*todopb.ListResponse, error) {
+	resp := &todopb.ListResponse{}
+	err := s.update(ctx, func(list *todo.List) ([]event, error) {
+		for i := range *list {
+			resp.Items = append(resp.Items, itemMessage(list, i+1))
+		}
+		return nil, nil
+	})
+	return resp, err
+}
+
+func (s *todoService) Get(ctx context.Context, req *todopb.ItemRequest) (*todopb.Item, error) {
+	var item *todopb.Item
+	err := s.update(ctx, func(list *todo.List) ([]event, error) {
+		if err := checkID(list, req.Id); err != nil {
+			return nil, err
+		}
+		item = itemMessage(list, int(req.Id))
+		return nil, nil
+	})
+	return item, err
+}
+
+func (s *todoService) Add(ctx context.Context, req *todopb.AddRequest) (*todopb.Item, error) {
+	if err := s.checkTask(req.Task); err != nil {
+		return nil, err
+	}
+	var item *todopb.Item
+	err := s.update(ctx, func(list *todo.List) ([]event, error) {
+		if s.lim.maxItems > 0 && len(*list) >= s.lim.maxItems {
+			return nil, status.Error(codes.ResourceExhausted,
+				fmt.Sprintf("%s: %d items allowed", ErrListFull, s.lim.maxItems))
+		}
+		list.Add(req.Task)
+		id := len(*list)
+		item = itemMessage(list, id)
+		return []event{{Type: eventAdded, Position: id, Item: (*list)[id-1]}}, nil
+	})
+	return item, err
+}
+
+func (s *todoService) Complete(ctx context.Context, req *todopb.ItemRequest) (*todopb.Item, error) {
+	var item *todopb.Item
+	err := s.update(ctx, func(list *todo.List) ([]event, error) {
+		if err := checkID(list, req.Id); err != nil {
+			return nil, err
+		}
+		id := int(req.Id)
+		before := (*list)[id-1]
+		if err := list.Complete(id); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		item = itemMessage(list, id)
+		return []event{{Type: eventCompleted, Position: id, Item: (*list)[id-1], Before: before}}, nil
+	})
+	return item, err
+}
+
+func (s *todoService) Delete(ctx context.Context, req *todopb.ItemRequest) (*todopb.Item, error) {
+	var item *todopb.Item
+	st := s.stores.forContext(ctx)
+	err := s.update(ctx, func(list *todo.List) ([]event, error) {
+		if err := checkID(list, req.Id); err != nil {
+			return nil, err
+		}
+		id := int(req.Id)
+		item = itemMessage(list, id)
+		deleted := (*list)[id-1]
+		if err := st.remove(list, id); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return []event{{Type: eventDeleted, Position: id, Item: deleted}}, nil
+	})
+	return item, err
+}
+
+// Update renames the item first and then moves it, the returned item
+// has its new number.
+func (s *todoService) Update(ctx context.Context, req *todopb.UpdateRequest) (*todopb.Item, error) {
+	if req.Task == nil && req.MoveTo == nil {
+		return nil, status.Error(codes.InvalidArgument,
+			fmt.Sprintf("%s: task or move_to is required", ErrInvalidData))
+	}
+	if req.Task != nil {
+		if err := s.checkTask(*req.Task); err != nil {
+			return nil, err
+		}
+	}
+	var item *todopb.Item
+	err := s.update(ctx, func(list *todo.List) ([]event, error) {
+		if err := checkID(list, req.Id); err != nil {
+			return nil, err
+		}
+		id := int(req.Id)
+		var events []event
+		if req.Task != nil {
+			before := (*list)[id-1]
+			if err := list.Edit(id, *req.Task); err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			events = append(events, event{Type: eventEdited, Position: id, Item: (*list)[id-1], Before: before})
+		}
+		if req.MoveTo != nil {
+			to := int(*req.MoveTo)
+			if to < 1 || to > len(*list) {
+				return nil, status.Error(codes.InvalidArgument,
+					fmt.Sprintf("%s: move_to %d", ErrInvalidData, to))
+			}
+			if err := list.Move(id, to); err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			events = append(events, event{Type: eventReordered, Position: id, To: to, Item: (*list)[to-1]})
+			id = to
+		}
+		item = itemMessage(list, id)
+		return events, nil
+	})
+	return item, err
+}
+
+// Watch sends the changes of the caller's list after last_event_id. A
+// stream.reset event tells the client to reload the list. The stream
+// ends with Unavailable on shutdown or when the client falls behind, so
+// clients resume with the last ID they saw.
+func (s *todoService) Watch(req *todopb.WatchRequest, stream grpc.ServerStreamingServer[todopb.Event]) error {
+	st := s.stores.forContext(stream.Context())
+	backlog, ch, reset := st.events.subscribe(req.LastEventId, req.LastEventId != 0)
+	defer st.events.unsubscribe(ch)
+
+	// Headers tell the client that no change is missed from here on.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	if reset {
+		if err := stream.Send(&todopb.Event{Type: eventReset}); err != nil {
+			return err
+		}
+	}
+	for _, e := range backlog {
+		if err := stream.Send(eventMessage(e)); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case e, ok := <-ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "change stream closed")
+			}
+			if err := stream.Send(eventMessage(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"pragprog.com/rggo/apis/todo_server/todopb"
+)
+
+func TestGRPC(t *testing.T) {
+	dir := t.TempDir()
+	users := userList{{Name: "alice", Token: "alice-token"}}
+	a := newApp(config{todoFile: dir + "/shared.json", dataDir: dir, users: users,
+		limits: limits{maxTaskLen: 20}})
+
+	// REST and gRPC share a's stores.
+	ts := httptest.NewServer(a.routes())
+	defer ts.Close()
+
+	lis := bufconn.Listen(1 << 20)
+	gs := newGRPCServer(a, nil)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := todopb.NewTodoClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	authed := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer alice-token")
+
+	expCode := func(t *testing.T, err error, exp codes.Code) {
+		t.Helper()
+		if status.Code(err) != exp {
+			t.Fatalf("Expected %s, got %v", exp, err)
+		}
+	}
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		_, err := client.List(ctx, &todopb.ListRequest{})
+		expCode(t, err, codes.Unauthenticated)
+	})
+
+	stream, err := client.Watch(authed, &todopb.WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		for _, task := range []string{"gRPC task 1", "gRPC task 2"} {
+			item, err := client.Add(authed, &todopb.AddRequest{Task: task})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Task != task || item.Done || item.CreatedAt == nil {
+				t.Errorf("Unexpected item %v", item)
+			}
+		}
+		_, err := client.Add(authed, &todopb.AddRequest{Task: strings.Repeat("x", 21)})
+		expCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		e, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != eventAdded || e.Position != 1 || e.Item.GetTask() != "gRPC task 1" {
+			t.Errorf("Unexpected event %v", e)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		item, err := client.Update(authed, &todopb.UpdateRequest{Id: 1, Task: proto.String("Renamed"), MoveTo: proto.Int32(2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Id != 2 || item.Task != "Renamed" {
+			t.Errorf("Expected item 2 renamed, got %v", item)
+		}
+		_, err = client.Update(authed, &todopb.UpdateRequest{Id: 1})
+		expCode(t, err, codes.InvalidArgument)
+		_, err = client.Update(authed, &todopb.UpdateRequest{Id: 1, MoveTo: proto.Int32(5)})
+		expCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		item, err := client.Complete(authed, &todopb.ItemRequest{Id: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !item.Done || item.CompletedAt == nil {
+			t.Errorf("Expected item completed, got %v", item)
+		}
+	})
+
+	t.Run("Shared with REST", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/todo/2", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer alice-token")
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		var resp todoResponse
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Results) != 1 || resp.Results[0].Task != "Renamed" || !resp.Results[0].Done {
+			t.Errorf("Expected the gRPC changes over REST, got %v", resp.Results)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		item, err := client.Delete(authed, &todopb.ItemRequest{Id: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Task != "gRPC task 2" {
+			t.Errorf("Expected deleted item returned, got %v", item)
+		}
+		list, err := client.List(authed, &todopb.ListRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != 1 || list.Items[0].Id != 1 || list.Items[0].Task != "Renamed" {
+			t.Errorf("Unexpected list %v", list.Items)
+		}
+		_, err = client.Get(authed, &todopb.ItemRequest{Id: 2})
+		expCode(t, err, codes.NotFound)
+	})
+}
@@ -4,42 +4,109 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"pragprog.com/rggo/interacting/todo"
 	"strconv"
-	"sync"
+	"strings"
+	"unicode/utf8"
 )
 
 var (
 	ErrNotFound    = errors.New("Not Found")
 	ErrInvalidData = errors.New("Indalid Data")
+	ErrListFull    = errors.New("List is full")
 )
 
+// rootIndex points API clients at the endpoints.
+const rootIndex = `Todo API
+
+Items:   /todo
+Spec:    /openapi.json
+Web UI:  /ui/
+`
+
+// rootHandler sends browsers to the web UI and answers other clients
+// with an index of the API.
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+		replyErrorContent(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+		return
 	}
-	content := "There is rootHandler response"
-	replyTextContent(w, r, http.StatusOK, content)
+	replyTextContent(w, r, http.StatusOK, rootIndex)
 }
 
-func todoRouter(todoFile string, l sync.Locker) http.HandlerFunc {
+func todoRouter(stores *storeSet, lim limits, view *htmlView, reports *reportTemplates) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		list := &todo.List{}
+		st := stores.forRequest(r)
+
+		if r.URL.Path == "events" {
+			eventsHandler(w, r, st)
+			return
+		}
 
-		l.Lock()
-		defer l.Unlock()
+		st.lock()
+		defer st.Unlock()
 
-		if err := list.GetFile(todoFile); err != nil {
+		if err := st.load(list); err != nil {
 			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
+		if r.URL.Path == "batch" {
+			batchHandler(w, r, list, st, lim)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "charts/") {
+			chartsHandler(w, r, list)
+			return
+		}
+		if r.URL.Path == "stats" {
+			statsHandler(w, r, list)
+			return
+		}
+		if r.URL.Path == "timer" {
+			timerHandler(w, r, list, st, lim)
+			return
+		}
+		if r.URL.Path == "timesheet" {
+			timesheetHandler(w, r, list)
+			return
+		}
+		if r.URL.Path == "report" {
+			reportHandler(w, r, list, reports)
+			return
+		}
+		if r.URL.Path == "search" {
+			searchHandler(w, r, list, st)
+			return
+		}
+		if isTrashPath(r.URL.Path) {
+			trashRouter(w, r, list, st, lim)
+			return
+		}
 		if r.URL.Path == "" {
 			switch r.Method {
 			case http.MethodGet:
-				getAllHandler(w, r, list)
+				format, ok := negotiate(w, r, listFormats)
+				switch {
+				case !ok:
+					replyNotAcceptable(w, r, listFormats)
+				case format == formatHTML:
+					view.renderList(w, r, list, lim)
+				case !notModified(w, r, st, format):
+					getAllHandler(w, r, list, format)
+				}
 			case http.MethodPost:
-				addHandler(w, r, list, todoFile)
+				if isForm(r) {
+					view.addForm(w, r, list, st, lim)
+					return
+				}
+				addHandler(w, r, list, st, lim)
 			default:
 				message := "Method not supported"
 				replyErrorContent(w, r, http.StatusMethodNotAllowed, message)
@@ -58,11 +125,25 @@ func todoRouter(todoFile string, l sync.Locker) http.HandlerFunc {
 		}
 		switch r.Method {
 		case http.MethodGet:
-			getOneHandler(w, r, list, id)
+			format, ok := negotiate(w, r, itemFormats)
+			if !ok {
+				replyNotAcceptable(w, r, itemFormats)
+				return
+			}
+			if notModified(w, r, st, format) {
+				return
+			}
+			getOneHandler(w, r, list, id, format)
 		case http.MethodDelete:
-			deleteHandler(w, r, list, id, todoFile)
+			deleteHandler(w, r, list, id, st)
 		case http.MethodPatch:
-			patchHandler(w, r, list, id, todoFile)
+			patchHandler(w, r, list, id, st, lim)
+		case http.MethodPost:
+			if !isForm(r) {
+				replyErrorContent(w, r, http.StatusUnsupportedMediaType, "Only HTML forms can be posted to an item")
+				return
+			}
+			view.itemForm(w, r, list, id, st)
 		default:
 			message := "Method not supported"
 			replyErrorContent(w, r, http.StatusMethodNotAllowed, message)
@@ -71,66 +152,127 @@ func todoRouter(todoFile string, l sync.Locker) http.HandlerFunc {
 	}
 }
 
-func getAllHandler(w http.ResponseWriter, r *http.Request, list *todo.List) {
-	resp := &todoResponse{
-		Results: *list,
-	}
-	replyJSONContent(w, r, http.StatusOK, resp)
+func getAllHandler(w http.ResponseWriter, r *http.Request, list *todo.List, format string) {
+	replyItems(w, r, format, *list, 1)
 }
 
-func addHandler(w http.ResponseWriter, r *http.Request, list *todo.List, file string) {
+func addHandler(w http.ResponseWriter, r *http.Request, list *todo.List, st *store, lim limits) {
 	item := struct {
 		Task string `json:"task"`
 	}{}
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			replyErrorContent(w, r, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
 		message := fmt.Sprintf("Invalid JSON: %s", err)
 		replyErrorContent(w, r, http.StatusBadRequest, message)
 		return
 	}
+	if lim.maxTaskLen > 0 && utf8.RuneCountInString(item.Task) > lim.maxTaskLen {
+		message := fmt.Sprintf("%s: task longer than %d characters", ErrInvalidData, lim.maxTaskLen)
+		replyErrorContent(w, r, http.StatusBadRequest, message)
+		return
+	}
+	if lim.maxItems > 0 && len(*list) >= lim.maxItems {
+		message := fmt.Sprintf("%s: %d items allowed", ErrListFull, lim.maxItems)
+		replyErrorContent(w, r, http.StatusConflict, message)
+		return
+	}
 	list.Add(item.Task)
-	if err := list.Save(file); err != nil {
+	e := event{Type: eventAdded, Position: len(*list), Item: (*list)[len(*list)-1]}
+	if err := st.commit(r.Context(), list, e); err != nil {
 		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 	replyTextContent(w, r, http.StatusCreated, "Item added")
 }
 
-func getOneHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int) {
-	resp := &todoResponse{}
+func getOneHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int, format string) {
 	item, err := list.Get(id)
 	if err != nil {
 		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	resp.Results = append(resp.Results, *item)
-	replyJSONContent(w, r, http.StatusOK, resp)
+	replyItems(w, r, format, todo.List{*item}, id)
 }
 
-func deleteHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int, file string) {
-	list.Delete(id)
-	if err := list.Save(file); err != nil {
+func deleteHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int, st *store) {
+	e := event{Type: eventDeleted, Position: id, Item: (*list)[id-1]}
+	if err := st.remove(list, id); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := st.commit(r.Context(), list, e); err != nil {
 		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 	replyTextContent(w, r, http.StatusNoContent, "")
 }
 
-func patchHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int, file string) {
+// patchHandler completes an item with ?complete, moves it with ?move=N or
+// renames it with a {"Task": "..."} or {"task": "..."} body.
+func patchHandler(w http.ResponseWriter, r *http.Request, list *todo.List, id int, st *store, lim limits) {
 	q := r.URL.Query()
-	if _, ok := q["complete"]; !ok {
-		message := "Missing or bad query parameter 'complete'"
-		replyErrorContent(w, r, http.StatusBadRequest, message)
-		return
-	}
-	if err := list.Complete(id); err != nil {
-		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
-		return
+	var (
+		e       event
+		message string
+	)
+	before := (*list)[id-1]
+	switch {
+	case q.Has("complete"):
+		if err := list.Complete(id); err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		e = event{Type: eventCompleted, Position: id, Item: (*list)[id-1], Before: before}
+		message = "Item status changed"
+	case q.Has("move"):
+		to, err := strconv.Atoi(q.Get("move"))
+		if err != nil || to < 1 || to > len(*list) {
+			message := fmt.Sprintf("%s: bad query parameter 'move'", ErrInvalidData)
+			replyErrorContent(w, r, http.StatusBadRequest, message)
+			return
+		}
+		if err := list.Move(id, to); err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		e = event{Type: eventReordered, Position: id, To: to, Item: (*list)[to-1]}
+		message = "Item moved"
+	default:
+		body, err := io.ReadAll(r.Body)
+		if err != nil || len(body) == 0 {
+			message := "Missing query parameter 'complete' or 'move', or task body"
+			replyErrorContent(w, r, http.StatusBadRequest, message)
+			return
+		}
+		item := struct {
+			Task string `json:"task"`
+		}{}
+		if err := json.Unmarshal(body, &item); err != nil {
+			message := fmt.Sprintf("Invalid JSON: %s", err)
+			replyErrorContent(w, r, http.StatusBadRequest, message)
+			return
+		}
+		if lim.maxTaskLen > 0 && utf8.RuneCountInString(item.Task) > lim.maxTaskLen {
+			message := fmt.Sprintf("%s: task longer than %d characters", ErrInvalidData, lim.maxTaskLen)
+			replyErrorContent(w, r, http.StatusBadRequest, message)
+			return
+		}
+		if err := list.Edit(id, item.Task); err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		e = event{Type: eventEdited, Position: id, Item: (*list)[id-1], Before: before}
+		message = "Item updated"
 	}
-	if err := list.Save(file); err != nil {
+	if err := st.commit(r.Context(), list, e); err != nil {
 		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	replyTextContent(w, r, http.StatusOK, "Item status changed")
+	replyTextContent(w, r, http.StatusOK, message)
 }
 
 func validate(path string, list *todo.List) (int, error) {
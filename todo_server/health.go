@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	replyTextContent(w, r, http.StatusOK, "OK")
+}
+
+// readyHandler reports whether the server can serve lists: it is not
+// shutting down, its storage can be read and written and its audit log
+// is not broken.
+func readyHandler(a *app) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.draining.Load() {
+			replyTextContent(w, r, http.StatusServiceUnavailable, "Shutting down")
+			return
+		}
+		if err := checkStorage(a); err != nil {
+			a.logger.Warn("Storage not ready", "error", err)
+			replyTextContent(w, r, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err := a.cfg.audit.check(); err != nil {
+			a.logger.Warn("Audit log broken", "error", err)
+			replyTextContent(w, r, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		replyTextContent(w, r, http.StatusOK, "OK")
+	}
+}
+
+func checkStorage(a *app) error {
+	dir := filepath.Dir(a.cfg.todoFile)
+	if a.cfg.users != nil {
+		dir = a.cfg.dataDir
+	} else {
+		st := a.stores.shared
+		st.lock()
+		err := st.load(&todo.List{})
+		st.Unlock()
+		if err != nil {
+			return fmt.Errorf("store not readable: %w", err)
+		}
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("store not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
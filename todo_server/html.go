@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+const (
+	formMediaType = "application/x-www-form-urlencoded"
+	// csrfTTL is how long a rendered form can be submitted.
+	csrfTTL = 12 * time.Hour
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var pageTemplates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// formErrors are the messages the list page shows for ?error=. Only
+// known codes are shown so the query cannot put text on the page.
+var formErrors = map[string]string{
+	"task-empty": "Enter a task to add.",
+	"task-long":  "That task is too long.",
+	"list-full":  "The list is full, delete an item first.",
+	"expired":    "The form expired, please try again.",
+	"stale":      "The list changed since you loaded it, nothing was done.",
+}
+
+// htmlView renders the list for browsers and handles its forms. The
+// CSRF key is made at start so tokens expire with the server too.
+type htmlView struct {
+	key []byte
+	now func() time.Time
+}
+
+func newHTMLView() *htmlView {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &htmlView{key: key, now: time.Now}
+}
+
+func isForm(r *http.Request) bool {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return ct == formMediaType
+}
+
+func (v *htmlView) sign(user, ts string) string {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte(user + "\x00" + ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// csrfToken is a timestamp signed for user, so forms need no server state.
+func (v *htmlView) csrfToken(user string) string {
+	ts := strconv.FormatInt(v.now().Unix(), 10)
+	return ts + "." + v.sign(user, ts)
+}
+
+func (v *htmlView) checkCSRF(user, token string) bool {
+	ts, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || v.now().Sub(time.Unix(sec, 0)) > csrfTTL {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(v.sign(user, ts)))
+}
+
+func requestUser(r *http.Request) string {
+	if u, ok := userFromContext(r.Context()); ok {
+		return u.Name
+	}
+	return ""
+}
+
+type listRow struct {
+	Number      int
+	Task        string
+	Done        bool
+	CompletedAt time.Time
+}
+
+type listPage struct {
+	User       string
+	CSRF       string
+	Error      string
+	MaxTaskLen int
+	Pending    int
+	Items      []listRow
+}
+
+// renderList writes the list page.
+func (v *htmlView) renderList(w http.ResponseWriter, r *http.Request, list *todo.List, lim limits) {
+	page := listPage{
+		User:       requestUser(r),
+		Error:      formErrors[r.URL.Query().Get("error")],
+		MaxTaskLen: lim.maxTaskLen,
+	}
+	page.CSRF = v.csrfToken(page.User)
+	for i, item := range *list {
+		page.Items = append(page.Items, listRow{
+			Number:      i + 1,
+			Task:        item.Task,
+			Done:        item.Done,
+			CompletedAt: item.CompletedAt,
+		})
+		if !item.Done {
+			page.Pending++
+		}
+	}
+	var b strings.Builder
+	if err := pageTemplates.ExecuteTemplate(&b, "list.html", page); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
+
+// seeList ends a form post by redirecting to the list, with an error
+// code when nothing was done.
+func seeList(w http.ResponseWriter, r *http.Request, code string) {
+	target := "/todo"
+	if code != "" {
+		target += "?error=" + url.QueryEscape(code)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// addForm adds the task of a form post to list.
+func (v *htmlView) addForm(w http.ResponseWriter, r *http.Request, list *todo.List, st *store, lim limits) {
+	if err := r.ParseForm(); err != nil {
+		replyErrorContent(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !v.checkCSRF(requestUser(r), r.PostForm.Get("csrf")) {
+		seeList(w, r, "expired")
+		return
+	}
+	task := strings.TrimSpace(r.PostForm.Get("task"))
+	switch {
+	case task == "":
+		seeList(w, r, "task-empty")
+		return
+	case lim.maxTaskLen > 0 && utf8.RuneCountInString(task) > lim.maxTaskLen:
+		seeList(w, r, "task-long")
+		return
+	case lim.maxItems > 0 && len(*list) >= lim.maxItems:
+		seeList(w, r, "list-full")
+		return
+	}
+	list.Add(task)
+	e := event{Type: eventAdded, Position: len(*list), Item: (*list)[len(*list)-1]}
+	if err := st.commit(r.Context(), list, e); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	seeList(w, r, "")
+}
+
+// itemForm completes or deletes item id. The form carries the task it
+// was rendered with, so a list changed in between is not touched.
+func (v *htmlView) itemForm(w http.ResponseWriter, r *http.Request, list *todo.List, id int, st *store) {
+	if err := r.ParseForm(); err != nil {
+		replyErrorContent(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !v.checkCSRF(requestUser(r), r.PostForm.Get("csrf")) {
+		seeList(w, r, "expired")
+		return
+	}
+	if task, ok := r.PostForm["task"]; ok && task[0] != (*list)[id-1].Task {
+		seeList(w, r, "stale")
+		return
+	}
+	var e event
+	switch r.PostForm.Get("action") {
+	case "complete":
+		before := (*list)[id-1]
+		list.Complete(id)
+		e = event{Type: eventCompleted, Position: id, Item: (*list)[id-1], Before: before}
+	case "delete":
+		e = event{Type: eventDeleted, Position: id, Item: (*list)[id-1]}
+		if err := st.remove(list, id); err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	default:
+		replyErrorContent(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+	if err := st.commit(r.Context(), list, e); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	seeList(w, r, "")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayHeader marks a response served from the store.
+	idempotentReplayHeader = "Idempotent-Replayed"
+)
+
+// idempotentResponse is the outcome of the first request made with a
+// key. done is false while that request is still running.
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte
+	created     time.Time
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+}
+
+// idempotencyStore keeps responses by user and key for window.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*idempotentResponse
+	now     func() time.Time
+}
+
+func newIdempotencyStore(window time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		window:  window,
+		entries: map[string]*idempotentResponse{},
+		now:     time.Now,
+	}
+}
+
+// begin returns a copy of the entry for key. When there is none it
+// reserves key and the caller must call finish or abandon.
+func (s *idempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (idempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if e, found := s.entries[key]; found && now.Sub(e.created) < s.window {
+		return *e, true
+	}
+	s.sweep(now)
+	s.entries[key] = &idempotentResponse{fingerprint: fingerprint, created: now}
+	return idempotentResponse{}, false
+}
+
+func (s *idempotencyStore) finish(key string, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.done, e.status, e.contentType, e.body = true, status, contentType, body
+	}
+}
+
+// abandon forgets a key whose request failed on the server side, so the
+// client can retry it.
+func (s *idempotencyStore) abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// sweep drops expired entries.
+func (s *idempotencyStore) sweep(now time.Time) {
+	for k, e := range s.entries {
+		if now.Sub(e.created) >= s.window {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// responseCapture copies what a handler writes.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	if rc.status == 0 {
+		rc.status = status
+	}
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.status == 0 {
+		rc.status = http.StatusOK
+	}
+	rc.body.Write(b)
+	return rc.ResponseWriter.Write(b)
+}
+
+func (rc *responseCapture) Unwrap() http.ResponseWriter {
+	return rc.ResponseWriter
+}
+
+// idempotent replays the stored response of a POST sent again with the
+// same Idempotency-Key by the same user within window. Reusing a key for
+// a different request is rejected with 422, and a retry that arrives
+// while the first request still runs with 409. Server errors are not
+// stored. A zero window disables it.
+func idempotent(window time.Duration) middleware {
+	return func(next http.Handler) http.Handler {
+		if window <= 0 {
+			return next
+		}
+		store := newIdempotencyStore(window)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validRequestID(key) {
+				replyErrorContent(w, r, http.StatusBadRequest, "Invalid Idempotency-Key")
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					replyErrorContent(w, r, http.StatusRequestEntityTooLarge, err.Error())
+					return
+				}
+				replyErrorContent(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			owner := ""
+			if u, ok := userFromContext(r.Context()); ok {
+				owner = u.Name
+			}
+			storeKey := owner + "\x00" + key
+			fingerprint := sha256.Sum256([]byte(r.URL.Path + "\x00" + string(body)))
+
+			if e, found := store.begin(storeKey, fingerprint); found {
+				switch {
+				case !e.done:
+					w.Header().Set("Retry-After", "1")
+					replyErrorContent(w, r, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+				case e.fingerprint != fingerprint:
+					replyErrorContent(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+				default:
+					w.Header().Set("Content-Type", e.contentType)
+					w.Header().Set(idempotentReplayHeader, "true")
+					w.WriteHeader(e.status)
+					w.Write(e.body)
+				}
+				return
+			}
+
+			rc := &responseCapture{ResponseWriter: w}
+			next.ServeHTTP(rc, r)
+			if rc.status >= http.StatusInternalServerError {
+				store.abandon(storeKey)
+				return
+			}
+			if rc.status == 0 {
+				rc.status = http.StatusOK
+			}
+			store.finish(storeKey, rc.status, rc.Header().Get("Content-Type"), rc.body.Bytes())
+		})
+	}
+}
@@ -1,29 +1,155 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
 )
 
 func main() {
-	host := flag.String("h", "localhost", "Server host")
-	port := flag.Int("p", 8080, "Server port")
-	todoFile := flag.String("f", "todo_server.json", "File name to store")
+	configFile := flag.String("config", os.Getenv("TODO_SERVER_CONFIG"), "Config file (YAML, TOML or JSON)")
+	migrateTo := flag.String("migrate-to", "", "Copy the shared file to this user's list and exit")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration and exit")
+	defineFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [verify [audit file]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	st, err := loadSettings(flag.CommandLine, *configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %s\n", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		if err := printSettings(os.Stdout, st); err != nil {
+			fmt.Fprintf(os.Stderr, "Fail to print configuration: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "verify" {
+		file := st.Audit.File
+		if flag.NArg() > 1 {
+			file = flag.Arg(1)
+		}
+		if file == "" {
+			fmt.Fprintln(os.Stderr, "No audit log: set -audit-file or name the file to verify")
+			os.Exit(1)
+		}
+		n, err := verifyAudit(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Audit log %s: %s\n", file, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Audit log %s: %d entries, chain intact\n", file, n)
+		return
+	}
+
+	logger, err := newLogger(os.Stderr, st.Log.Format, st.Log.Level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging options: %s\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	cfg, err := newConfig(st, logger)
+	if err != nil {
+		logger.Error("Fail to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	if *migrateTo != "" {
+		stores := newStoreSet(cfg.todoFile, cfg.dataDir, nil, nil, nil, 0)
+		if err := migrateShared(cfg.todoFile, stores, cfg.users, *migrateTo); err != nil {
+			logger.Error("Fail to migrate", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("File assigned to user", "file", cfg.todoFile, "user", *migrateTo)
+		return
+	}
+
+	tlsOpts := st.tlsOptions()
+	tlsCfg, err := serverTLSConfig(tlsOpts, st.Listen.Host)
+	if err != nil {
+		logger.Error("Fail to set up TLS", "error", err)
+		os.Exit(1)
+	}
+	if tlsOpts.clientCA != "" && tlsCfg == nil {
+		logger.Error("Fail to set up TLS", "error", "-tls-client-ca needs -tls-cert or -tls-self-signed")
+		os.Exit(1)
+	}
+
+	a := newApp(cfg)
 	s := &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", *host, *port),
-		Handler:      newMux(*todoFile),
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Addr:         fmt.Sprintf("%s:%d", st.Listen.Host, st.Listen.Port),
+		Handler:      a.routes(),
+		ReadTimeout:  st.Timeouts.Read,
+		WriteTimeout: st.Timeouts.Write,
+		TLSConfig:    tlsCfg,
+	}
+	s.RegisterOnShutdown(a.stores.closeEvents)
+	cfg.webhooks.start()
+
+	var gs *grpc.Server
+	var grpcLis net.Listener
+	if st.GRPC.Port != 0 {
+		grpcLis, err = net.Listen("tcp", fmt.Sprintf("%s:%d", st.Listen.Host, st.GRPC.Port))
+		if err != nil {
+			logger.Error("Fail to start gRPC server", "error", err)
+			os.Exit(1)
+		}
+		gs = newGRPCServer(a, tlsCfg)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("Server started", "host", st.Listen.Host, "port", st.Listen.Port,
+			"file", cfg.todoFile, "tls", tlsOpts.enabled(), "mtls", tlsOpts.clientCA != "")
+		if tlsCfg != nil {
+			errCh <- s.ListenAndServeTLS("", "")
+			return
+		}
+		errCh <- s.ListenAndServe()
+	}()
+	if gs != nil {
+		go func() {
+			logger.Info("gRPC server started", "host", st.Listen.Host, "port", st.GRPC.Port)
+			errCh <- gs.Serve(grpcLis)
+		}()
 	}
 
-	fmt.Printf("Server started at %s, port %d\nUsing file %s", *host, *port, *todoFile)
-	if err := s.ListenAndServe(); err != nil {
-		fmt.Fprintf(os.Stderr, "Fail to start server: %s", err)
+	select {
+	case err := <-errCh:
+		logger.Error("Fail to start server", "error", err)
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+	stop()
+
+	logger.Info("Shutting down", "timeout", st.Timeouts.Shutdown)
+	a.draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), st.Timeouts.Shutdown)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Fail to drain connections", "error", err)
+	}
+	if gs != nil {
+		stopGRPC(shutdownCtx, gs)
 	}
+	a.stores.flush()
+	cfg.webhooks.stop()
+	logger.Info("Server stopped")
 }
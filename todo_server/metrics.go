@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBuckets are the histogram upper bounds in seconds.
+var defaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(defaultBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range defaultBuckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, b := range defaultBuckets {
+		le := strconv.FormatFloat(b, 'g', -1, 64)
+		fmt.Fprintf(w, "%s_bucket{%s%sle=%q} %d\n", name, labels, sep, le, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, braces(labels), h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braces(labels), h.count)
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+type requestLabels struct {
+	route  string
+	method string
+	status int
+}
+
+func (l requestLabels) String() string {
+	return fmt.Sprintf("route=%q,method=%q,status=\"%d\"", l.route, l.method, l.status)
+}
+
+type listCount struct {
+	items     int
+	completed int
+}
+
+// metrics collects the values exposed at /metrics. A nil *metrics is
+// valid and records nothing.
+type metrics struct {
+	mu sync.Mutex
+
+	requests      map[requestLabels]uint64
+	requestTimes  map[requestLabels]*histogram
+	loadTimes     *histogram
+	saveTimes     *histogram
+	storageErrors map[string]uint64
+	lockWait      *histogram
+	lists         map[string]listCount
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:      map[requestLabels]uint64{},
+		requestTimes:  map[requestLabels]*histogram{},
+		loadTimes:     newHistogram(),
+		saveTimes:     newHistogram(),
+		storageErrors: map[string]uint64{"load": 0, "save": 0},
+		lockWait:      newHistogram(),
+		lists:         map[string]listCount{},
+	}
+}
+
+func (m *metrics) observeRequest(l requestLabels, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[l]++
+	h, ok := m.requestTimes[l]
+	if !ok {
+		h = newHistogram()
+		m.requestTimes[l] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// observeStorage records a load or save of a list file.
+func (m *metrics) observeStorage(op string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.storageErrors[op]++
+		return
+	}
+	switch op {
+	case "load":
+		m.loadTimes.observe(d.Seconds())
+	case "save":
+		m.saveTimes.observe(d.Seconds())
+	}
+}
+
+func (m *metrics) observeLockWait(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lockWait.observe(d.Seconds())
+}
+
+// setList remembers the current size of the list kept in file.
+func (m *metrics) setList(file string, c listCount) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lists[file] = c
+}
+
+func (m *metrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestLabels, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b requestLabels) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	fmt.Fprintln(w, "# HELP todo_http_requests_total Total HTTP requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE todo_http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "todo_http_requests_total{%s} %d\n", k, m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP todo_http_request_duration_seconds HTTP request latency by route, method and status.")
+	fmt.Fprintln(w, "# TYPE todo_http_request_duration_seconds histogram")
+	for _, k := range keys {
+		m.requestTimes[k].write(w, "todo_http_request_duration_seconds", k.String())
+	}
+
+	fmt.Fprintln(w, "# HELP todo_storage_load_duration_seconds Time spent reading list files.")
+	fmt.Fprintln(w, "# TYPE todo_storage_load_duration_seconds histogram")
+	m.loadTimes.write(w, "todo_storage_load_duration_seconds", "")
+
+	fmt.Fprintln(w, "# HELP todo_storage_save_duration_seconds Time spent writing list files.")
+	fmt.Fprintln(w, "# TYPE todo_storage_save_duration_seconds histogram")
+	m.saveTimes.write(w, "todo_storage_save_duration_seconds", "")
+
+	fmt.Fprintln(w, "# HELP todo_storage_errors_total Failed list file operations by operation.")
+	fmt.Fprintln(w, "# TYPE todo_storage_errors_total counter")
+	for _, op := range []string{"load", "save"} {
+		fmt.Fprintf(w, "todo_storage_errors_total{op=%q} %d\n", op, m.storageErrors[op])
+	}
+
+	fmt.Fprintln(w, "# HELP todo_lock_wait_seconds Time requests waited for a list lock.")
+	fmt.Fprintln(w, "# TYPE todo_lock_wait_seconds histogram")
+	m.lockWait.write(w, "todo_lock_wait_seconds", "")
+
+	total := listCount{}
+	for _, c := range m.lists {
+		total.items += c.items
+		total.completed += c.completed
+	}
+	fmt.Fprintln(w, "# HELP todo_items Items currently stored in all lists.")
+	fmt.Fprintln(w, "# TYPE todo_items gauge")
+	fmt.Fprintf(w, "todo_items %d\n", total.items)
+	fmt.Fprintln(w, "# HELP todo_items_completed Completed items currently stored in all lists.")
+	fmt.Fprintln(w, "# TYPE todo_items_completed gauge")
+	fmt.Fprintf(w, "todo_items_completed %d\n", total.completed)
+}
+
+func metricsHandler(m *metrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteHeader(http.StatusOK)
+		m.writeTo(w)
+	}
+}
+
+// routeOf maps a request path to a fixed route label, so that item IDs
+// and unknown paths do not create new series.
+func routeOf(path string) string {
+	switch {
+	case path == "/", path == "/todo", path == "/metrics", path == "/admin/users",
+		path == "/healthz", path == "/readyz", path == "/openapi.json",
+		path == "/todo/events", path == "/todo/batch", path == "/admin/webhooks", path == "/admin/webhooks/deliveries",
+		path == "/graphql", path == "/audit", path == "/todo/trash",
+		path == "/todo/search", path == "/todo/stats", path == "/todo/report",
+		path == "/todo/timer", path == "/todo/timesheet":
+		return path
+	case strings.HasPrefix(path, "/todo/trash/") && strings.HasSuffix(path, "/restore"):
+		return "/todo/trash/{id}/restore"
+	case strings.HasPrefix(path, "/todo/charts/") && strings.HasSuffix(path, ".svg"):
+		return "/todo/charts/{name}.svg"
+	case strings.HasPrefix(path, "/ui/"):
+		return "/ui/"
+	case strings.HasPrefix(path, "/admin/webhooks/"):
+		return "/admin/webhooks/{id}"
+	case strings.HasPrefix(path, "/todo/"):
+		return "/todo/{id}"
+	}
+	return "other"
+}
+
+func methodOf(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// instrument records the request count and latency of every request.
+func instrument(m *metrics) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			m.observeRequest(requestLabels{
+				route:  routeOf(r.URL.Path),
+				method: methodOf(r.Method),
+				status: rec.status,
+			}, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h so that the first middleware is the outermost one.
+func chain(h http.Handler, mws ...middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// limitBody caps the size of request bodies. A zero size disables it.
+func limitBody(size int64) middleware {
+	return func(next http.Handler) http.Handler {
+		if size <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, size)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Headers a cross-origin browser client may send and read.
+const (
+	corsAllowMethods  = "GET, POST, PATCH, DELETE"
+	corsAllowHeaders  = "Authorization, Content-Type, Idempotency-Key, If-Modified-Since, If-None-Match, Last-Event-ID, X-Request-ID"
+	corsExposeHeaders = "ETag, Idempotent-Replayed, Retry-After, X-Request-ID"
+)
+
+// cors lets browsers on the allowed origins call the API, for a web UI
+// hosted apart from the server. "*" allows any origin. Preflight
+// requests are answered here, before authentication. No origins
+// disables it.
+func cors(origins []string) middleware {
+	return func(next http.Handler) http.Handler {
+		if len(origins) == 0 {
+			return next
+		}
+		anyOrigin := slices.Contains(origins, "*")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || !(anyOrigin || slices.Contains(origins, origin)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bucket is a token bucket refilled continuously at the limiter rate.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// allow takes a token for key. When the bucket is empty it returns the
+// time to wait until the next token is available.
+func (rl *rateLimiter) allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	b, ok := rl.buckets[key]
+	if !ok {
+		rl.sweep(now)
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have been refilled completely, so idle
+// clients do not accumulate in memory.
+func (rl *rateLimiter) sweep(now time.Time) {
+	full := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	for k, b := range rl.buckets {
+		if now.Sub(b.last) > full {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+// rateLimit throttles requests per user when the token is known and per
+// client IP otherwise. A zero rate disables it.
+func rateLimit(rate float64, burst int, users userList) middleware {
+	return func(next http.Handler) http.Handler {
+		if rate <= 0 {
+			return next
+		}
+		rl := newRateLimiter(rate, burst)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := rl.allow(clientKey(r, users))
+			if !ok {
+				secs := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				replyErrorContent(w, r, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientKey(r *http.Request, users userList) string {
+	if u, ok := users.byToken(requestToken(r)); ok {
+		return "user:" + u.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// readOnly refuses every method but GET.
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// Formats items can be sent in, named as in ?format=.
+const (
+	formatJSON     = "json"
+	formatHTML     = "html"
+	formatText     = "text"
+	formatCSV      = "csv"
+	formatYAML     = "yaml"
+	formatNDJSON   = "ndjson"
+	formatMarkdown = "md"
+)
+
+// formatTypes maps formats to their media types, the first one is sent.
+var formatTypes = map[string][]string{
+	formatJSON:     {"application/json"},
+	formatHTML:     {"text/html"},
+	formatText:     {"text/plain"},
+	formatCSV:      {"text/csv"},
+	formatYAML:     {"application/yaml", "application/x-yaml", "text/yaml"},
+	formatNDJSON:   {"application/x-ndjson", "application/ndjson"},
+	formatMarkdown: {"text/markdown"},
+}
+
+// Formats of GET /todo and GET /todo/{id}, in order of preference when
+// the client accepts several equally.
+var (
+	listFormats = []string{formatJSON, formatHTML, formatText, formatCSV, formatYAML, formatNDJSON}
+	itemFormats = []string{formatJSON, formatText, formatCSV, formatYAML, formatNDJSON}
+)
+
+// acceptQuality returns the q value r's Accept header gives mediaType,
+// from the most specific matching range. No header accepts anything.
+func acceptQuality(r *http.Request, mediaType string) float64 {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return 1
+	}
+	typ, _, _ := strings.Cut(mediaType, "/")
+	best, specificity := 0.0, -1
+	for part := range strings.SplitSeq(header, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case mt == mediaType:
+			s = 2
+		case mt == typ+"/*":
+			s = 1
+		case mt == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				q = 0
+			}
+		}
+		best, specificity = q, s
+	}
+	return best
+}
+
+// prefersHTML reports whether r ranks HTML above JSON. Ties go to JSON,
+// so API clients sending */* are not affected.
+func prefersHTML(r *http.Request) bool {
+	return acceptQuality(r, "text/html") > acceptQuality(r, "application/json")
+}
+
+// negotiate picks the format of formats to answer r with: the one named
+// by ?format=, or else the one its Accept header ranks highest. It
+// returns false when none is acceptable.
+func negotiate(w http.ResponseWriter, r *http.Request, formats []string) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	if f := r.URL.Query().Get("format"); f != "" {
+		for _, name := range formats {
+			if name == f {
+				return f, true
+			}
+		}
+		return "", false
+	}
+	best, bestQ := "", 0.0
+	for _, name := range formats {
+		for _, mt := range formatTypes[name] {
+			if q := acceptQuality(r, mt); q > bestQ {
+				best, bestQ = name, q
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// replyNotAcceptable lists the media types that formats offers.
+func replyNotAcceptable(w http.ResponseWriter, r *http.Request, formats []string) {
+	var types []string
+	for _, name := range formats {
+		types = append(types, formatTypes[name][0])
+	}
+	replyErrorContent(w, r, http.StatusNotAcceptable,
+		fmt.Sprintf("Not Acceptable: %s, or ?format=%s", strings.Join(types, ", "), strings.Join(formats, "|")))
+}
+
+// itemRow is an item in the CSV, YAML and NDJSON formats, which carry
+// the item number and use snake_case names.
+type itemRow struct {
+	ID          int        `json:"id" yaml:"id"`
+	Task        string     `json:"task" yaml:"task"`
+	Done        bool       `json:"done" yaml:"done"`
+	CreatedAt   time.Time  `json:"created_at" yaml:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" yaml:"completed_at,omitempty"`
+}
+
+func itemRows(list todo.List, first int) []itemRow {
+	rows := make([]itemRow, 0, len(list))
+	for i, it := range list {
+		row := itemRow{ID: first + i, Task: it.Task, Done: it.Done, CreatedAt: it.CreatedAt}
+		if !it.CompletedAt.IsZero() {
+			completed := it.CompletedAt
+			row.CompletedAt = &completed
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// replyItems sends the items of list, numbered from first, in format.
+// JSON keeps the todoResponse envelope and text the List.String() form.
+func replyItems(w http.ResponseWriter, r *http.Request, format string, list todo.List, first int) {
+	var body bytes.Buffer
+	switch format {
+	case formatJSON:
+		replyJSONContent(w, r, http.StatusOK, &todoResponse{Results: list})
+		return
+	case formatText:
+		if first == 1 {
+			body.WriteString(list.String())
+			break
+		}
+		for i, it := range list {
+			prefix := "  "
+			if it.Done {
+				prefix = "X "
+			}
+			fmt.Fprintf(&body, "%s%d: %s\n", prefix, first+i, it.Task)
+		}
+	case formatCSV:
+		cw := csv.NewWriter(&body)
+		cw.Write([]string{"id", "task", "done", "created_at", "completed_at"})
+		for _, row := range itemRows(list, first) {
+			completed := ""
+			if row.CompletedAt != nil {
+				completed = row.CompletedAt.Format(time.RFC3339)
+			}
+			cw.Write([]string{strconv.Itoa(row.ID), row.Task, strconv.FormatBool(row.Done),
+				row.CreatedAt.Format(time.RFC3339), completed})
+		}
+		cw.Flush()
+	case formatYAML:
+		data, err := yaml.Marshal(struct {
+			Results      []itemRow `yaml:"results"`
+			TotalResults int       `yaml:"total_results"`
+		}{itemRows(list, first), len(list)})
+		if err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		body.Write(data)
+	case formatNDJSON:
+		enc := json.NewEncoder(&body)
+		for _, row := range itemRows(list, first) {
+			if err := enc.Encode(row); err != nil {
+				replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+	}
+	ct := formatTypes[format][0]
+	if strings.HasPrefix(ct, "text/") {
+		ct += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", ct)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// The types below cover the part of OpenAPI 3 that openapi.json uses.
+// Parameters and responses may be $ref objects, schemas may use $ref,
+// type, format, properties, required, minProperties, maxProperties,
+// boolean additionalProperties, items, minLength, maxLength, minimum and
+// enum.
+
+type openAPISpec struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Parameters map[string]*parameter `json:"parameters"`
+		Responses  map[string]*response  `json:"responses"`
+		Schemas    map[string]*schema    `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                  `json:"required"`
+		Content  map[string]*mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref             string  `json:"$ref"`
+	Name            string  `json:"name"`
+	In              string  `json:"in"`
+	Required        bool    `json:"required"`
+	AllowEmptyValue bool    `json:"allowEmptyValue"`
+	Schema          *schema `json:"schema"`
+}
+
+type response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	MinProperties        *int               `json:"minProperties"`
+	MaxProperties        *int               `json:"maxProperties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Enum                 []any              `json:"enum"`
+}
+
+// route is a spec operation matched against a request.
+type route struct {
+	template string
+	op       *operation
+	params   map[string]string
+}
+
+func loadOpenAPI(doc []byte) (*openAPISpec, error) {
+	spec := &openAPISpec{}
+	if err := json.Unmarshal(doc, spec); err != nil {
+		return nil, err
+	}
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			for i, p := range op.Parameters {
+				if p.Ref == "" {
+					continue
+				}
+				resolved, ok := spec.Components.Parameters[refName(p.Ref)]
+				if !ok {
+					return nil, fmt.Errorf("%s %s: unknown parameter %s", method, path, p.Ref)
+				}
+				op.Parameters[i] = resolved
+			}
+			for status, resp := range op.Responses {
+				if resp.Ref == "" {
+					continue
+				}
+				resolved, ok := spec.Components.Responses[refName(resp.Ref)]
+				if !ok {
+					return nil, fmt.Errorf("%s %s: unknown response %s", method, path, resp.Ref)
+				}
+				op.Responses[status] = resolved
+			}
+		}
+	}
+	return spec, nil
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// find matches a request path against the path templates, preferring
+// literal segments over parameters. found is true when the path is in the
+// spec, op is nil when the method is not.
+func (s *openAPISpec) find(method, path string) (rt route, found bool) {
+	segs := strings.Split(path, "/")
+	for tmpl, ops := range s.Paths {
+		params, ok := matchPath(strings.Split(tmpl, "/"), segs)
+		if !ok || (found && len(params) >= len(rt.params)) {
+			continue
+		}
+		rt = route{template: tmpl, op: ops[strings.ToLower(method)], params: params}
+		found = true
+	}
+	return rt, found
+}
+
+func matchPath(tmpl, segs []string) (map[string]string, bool) {
+	if len(tmpl) != len(segs) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, t := range tmpl {
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if segs[i] == "" {
+				return nil, false
+			}
+			params[t[1:len(t)-1]] = segs[i]
+			continue
+		}
+		if t != segs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (s *openAPISpec) resolve(sc *schema) *schema {
+	for sc != nil && sc.Ref != "" {
+		sc = s.Components.Schemas[refName(sc.Ref)]
+	}
+	return sc
+}
+
+// validate checks a decoded JSON value against sc.
+func (s *openAPISpec) validate(sc *schema, v any, at string) error {
+	sc = s.resolve(sc)
+	if sc == nil {
+		return nil
+	}
+	if len(sc.Enum) > 0 && !slices.Contains(sc.Enum, v) {
+		return fmt.Errorf("%s: %v is not one of %v", at, v, sc.Enum)
+	}
+	switch sc.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object", at)
+		}
+		for _, name := range sc.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing property %q", at, name)
+			}
+		}
+		if sc.MinProperties != nil && len(obj) < *sc.MinProperties {
+			return fmt.Errorf("%s: fewer than %d properties", at, *sc.MinProperties)
+		}
+		if sc.MaxProperties != nil && len(obj) > *sc.MaxProperties {
+			return fmt.Errorf("%s: more than %d properties", at, *sc.MaxProperties)
+		}
+		for name, val := range obj {
+			prop, ok := sc.Properties[name]
+			if !ok {
+				if sc.AdditionalProperties != nil && !*sc.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", at, name)
+				}
+				continue
+			}
+			if err := s.validate(prop, val, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array", at)
+		}
+		for i, val := range arr {
+			if err := s.validate(sc.Items, val, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", at)
+		}
+		n := len([]rune(str))
+		if sc.MinLength != nil && n < *sc.MinLength {
+			return fmt.Errorf("%s: shorter than %d characters", at, *sc.MinLength)
+		}
+		if sc.MaxLength != nil && n > *sc.MaxLength {
+			return fmt.Errorf("%s: longer than %d characters", at, *sc.MaxLength)
+		}
+		if sc.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: invalid date-time %q", at, str)
+			}
+		}
+	case "integer", "number":
+		num, ok := v.(float64)
+		if !ok || (sc.Type == "integer" && num != float64(int64(num))) {
+			return fmt.Errorf("%s: expected %s", at, sc.Type)
+		}
+		if sc.Minimum != nil && num < *sc.Minimum {
+			return fmt.Errorf("%s: less than %v", at, *sc.Minimum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", at)
+		}
+	}
+	return nil
+}
+
+// validateParam checks a path or query value, which arrive as text.
+func (s *openAPISpec) validateParam(p *parameter, raw string) error {
+	if raw == "" && p.AllowEmptyValue {
+		return nil
+	}
+	var v any = raw
+	switch s.resolve(p.Schema).Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%s: expected number, got %q", p.Name, raw)
+		}
+		v = n
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: expected boolean, got %q", p.Name, raw)
+		}
+		v = b
+	}
+	return s.validate(p.Schema, v, p.Name)
+}
+
+var (
+	errUnsupportedMediaType = errors.New("Unsupported media type")
+	errBodyTooLarge         = errors.New("Request body too large")
+)
+
+// validateRequest checks parameters and body of r against the operation.
+// The body is read and replaced so handlers can still decode it.
+func (s *openAPISpec) validateRequest(r *http.Request, rt route) error {
+	q := r.URL.Query()
+	for _, p := range rt.op.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw, present = rt.params[p.Name]
+		case "query":
+			_, present = q[p.Name]
+			raw = q.Get(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				return fmt.Errorf("%w: missing %s parameter %q", ErrInvalidData, p.In, p.Name)
+			}
+			continue
+		}
+		if err := s.validateParam(p, raw); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidData, err)
+		}
+	}
+
+	rb := rt.op.RequestBody
+	if rb == nil {
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return fmt.Errorf("%w: %s", errBodyTooLarge, err)
+		}
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		if rb.Required {
+			return fmt.Errorf("%w: missing request body", ErrInvalidData)
+		}
+		return nil
+	}
+
+	// A missing Content-Type is read as JSON.
+	ct := "application/json"
+	if h := r.Header.Get("Content-Type"); h != "" {
+		if ct, _, err = mime.ParseMediaType(h); err != nil {
+			return fmt.Errorf("%w: %s", errUnsupportedMediaType, h)
+		}
+	}
+	mt, ok := rb.Content[ct]
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnsupportedMediaType, ct)
+	}
+	v, err := decodeBody(ct, body)
+	if err != nil {
+		return err
+	}
+	if err := s.validate(mt.Schema, v, "body"); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidData, err)
+	}
+	return nil
+}
+
+// decodeBody turns a JSON or form body into a value the schema checks
+// apply to. Form fields are strings and only their first value counts.
+func decodeBody(ct string, body []byte) (any, error) {
+	if ct == formMediaType {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("%w: Invalid form: %s", ErrInvalidData, err)
+		}
+		fields := make(map[string]any, len(values))
+		for k := range values {
+			fields[k] = values.Get(k)
+		}
+		return fields, nil
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, fmt.Errorf("%w: Invalid JSON: %s", ErrInvalidData, err)
+	}
+	return v, nil
+}
+
+// validateRequests rejects requests that do not match the spec. Paths
+// the spec does not describe are left to the mux.
+func validateRequests(s *openAPISpec) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, found := s.find(r.Method, r.URL.Path)
+			if !found {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if rt.op == nil {
+				replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+				return
+			}
+			if err := s.validateRequest(r, rt); err != nil {
+				status := http.StatusBadRequest
+				switch {
+				case errors.Is(err, errBodyTooLarge):
+					status = http.StatusRequestEntityTooLarge
+				case errors.Is(err, errUnsupportedMediaType):
+					status = http.StatusUnsupportedMediaType
+				}
+				replyErrorContent(w, r, status, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIDocument)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// contractCases exercise every operation in openapi.json. Each response
+// must be documented for its operation and match the documented schema.
+var contractCases = []struct {
+	method      string
+	path        string
+	contentType string
+	body        string
+	token       string
+	header      string
+	expCode     int
+}{
+	{method: "GET", path: "/", expCode: 200},
+	{method: "GET", path: "/todo", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo", expCode: 401},
+	{method: "POST", path: "/todo", body: `{"bogus":1}`, expCode: 401},
+	{method: "POST", path: "/todo", body: `<task/>`, header: "Content-Type: text/xml", expCode: 401},
+	{method: "GET", path: "/todo?error=stale", token: "alice-token", header: "Accept: text/html", expCode: 200},
+	{method: "GET", path: "/todo?format=csv", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo", token: "alice-token", header: "If-None-Match: *", expCode: 304},
+	{method: "GET", path: "/todo", token: "alice-token", header: "Accept: application/yaml", expCode: 200},
+	{method: "GET", path: "/todo", token: "alice-token", header: "Accept: application/xml", expCode: 406},
+	{method: "GET", path: "/todo?format=xml", token: "alice-token", expCode: 400},
+	{method: "POST", path: "/todo", token: "alice-token", body: "task=Form+task&csrf=bad", contentType: formMediaType, expCode: 303},
+	{method: "POST", path: "/todo/1", token: "alice-token", body: "action=complete&csrf=bad", contentType: formMediaType, expCode: 303},
+	{method: "POST", path: "/todo/1", token: "alice-token", body: "action=archive&csrf=bad", contentType: formMediaType, expCode: 400},
+	{method: "POST", path: "/todo/1", token: "alice-token", body: `{"action":"complete"}`, expCode: 415},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"task":"Contract task"}`, expCode: 201},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"task":"Once"}`, header: "Idempotency-Key: k1", expCode: 201},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"task":"Once"}`, header: "Idempotency-Key: k1", expCode: 201},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"task":"Twice"}`, header: "Idempotency-Key: k1", expCode: 422},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"task":""}`, expCode: 400},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"task":"x","done":true}`, expCode: 400},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"Task":"Old client"}`, expCode: 201},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{}`, expCode: 400},
+	{method: "POST", path: "/todo", token: "alice-token", body: `{"Task":"x","task":"y"}`, expCode: 400},
+	{method: "POST", path: "/todo", token: "alice-token", body: `task`, contentType: "text/plain", expCode: 415},
+	{method: "GET", path: "/todo/1", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/1", token: "alice-token", header: "Accept: application/x-ndjson", expCode: 200},
+	{method: "GET", path: "/todo/1?format=html", token: "alice-token", expCode: 406},
+	{method: "GET", path: "/todo/1", token: "alice-token", header: "If-Modified-Since: Fri, 01 Jan 2100 00:00:00 GMT", expCode: 304},
+	{method: "GET", path: "/todo/99", token: "alice-token", expCode: 404},
+	{method: "GET", path: "/todo/abc", token: "alice-token", expCode: 400},
+	{method: "PATCH", path: "/todo/1?complete", token: "alice-token", expCode: 200},
+	{method: "PATCH", path: "/todo/1", token: "alice-token", expCode: 400},
+	{method: "PATCH", path: "/todo/1", token: "alice-token", body: `{"task":"Renamed"}`, expCode: 200},
+	{method: "PATCH", path: "/todo/1?move=2", token: "alice-token", expCode: 200},
+	{method: "PATCH", path: "/todo/1?move=x", token: "alice-token", expCode: 400},
+	{method: "POST", path: "/todo/batch", token: "alice-token", body: `{"operations":[{"op":"add","task":"Batched"},{"op":"complete","id":1}]}`, expCode: 200},
+	{method: "POST", path: "/todo/batch", token: "alice-token", body: `{"operations":[{"op":"complete","id":1},{"op":"delete","id":99}]}`, expCode: 422},
+	{method: "POST", path: "/todo/batch", token: "alice-token", body: `{"operations":[{"op":"move","id":1}]}`, expCode: 400},
+	{method: "GET", path: "/todo/events", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/events", token: "alice-token", header: "Last-Event-ID: x", expCode: 400},
+	{method: "DELETE", path: "/todo/2", token: "alice-token", expCode: 204},
+	{method: "GET", path: "/todo/timer", token: "alice-token", expCode: 404},
+	{method: "POST", path: "/todo/timer", token: "alice-token", contentType: "application/json", body: `{"id":1,"note":"draft"}`, expCode: 201},
+	{method: "POST", path: "/todo/timer", token: "alice-token", contentType: "application/json", body: `{"id":2}`, expCode: 409},
+	{method: "POST", path: "/todo/timer", token: "alice-token", contentType: "application/json", body: `{"id":99}`, expCode: 404},
+	{method: "POST", path: "/todo/timer", token: "alice-token", contentType: "application/json", body: `{"note":"x"}`, expCode: 400},
+	{method: "GET", path: "/todo/timer", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/1", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/timesheet?period=week", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/timesheet?format=text", token: "alice-token", expCode: 200},
+	{method: "DELETE", path: "/todo/timer", token: "alice-token", expCode: 200},
+	{method: "DELETE", path: "/todo/timer", token: "alice-token", expCode: 404},
+	{method: "GET", path: "/todo/report?since=2w", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/report?format=html", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/report?since=soon", token: "alice-token", expCode: 400},
+	{method: "GET", path: "/todo/report?format=pdf", token: "alice-token", expCode: 400},
+	{method: "GET", path: "/todo/charts/burndown.svg?days=7", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/charts/burndown.svg?days=1", token: "alice-token", expCode: 400},
+	{method: "GET", path: "/todo/charts/heatmap.svg", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/stats", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/stats?format=text", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/stats", token: "alice-token", header: "Accept: text/csv", expCode: 406},
+	{method: "GET", path: "/todo/search?q=task", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/todo/search", token: "alice-token", expCode: 400},
+	{method: "GET", path: "/todo/trash", token: "alice-token", expCode: 200},
+	{method: "POST", path: "/todo/trash/1/restore", token: "alice-token", expCode: 200},
+	{method: "POST", path: "/todo/trash/9/restore", token: "alice-token", expCode: 404},
+	{method: "POST", path: "/todo/trash/x/restore", token: "alice-token", expCode: 400},
+	{method: "GET", path: "/admin/users", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/admin/users", token: "bob-token", expCode: 403},
+	{method: "POST", path: "/admin/webhooks", token: "alice-token", body: `{"url":"http://127.0.0.1:1/hook","secret":"s3cret","events":["item.added"]}`, expCode: 201},
+	{method: "POST", path: "/admin/webhooks", token: "alice-token", body: `{"url":"http://127.0.0.1:1/hook","secret":"s3cret","events":["item.gone"]}`, expCode: 400},
+	{method: "POST", path: "/admin/webhooks", token: "alice-token", body: `{"url":"ftp://example.com","secret":"s3cret"}`, expCode: 400},
+	{method: "GET", path: "/admin/webhooks", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/admin/webhooks", token: "bob-token", expCode: 403},
+	{method: "GET", path: "/admin/webhooks/deliveries?status=pending", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/admin/webhooks/deliveries?status=lost", token: "alice-token", expCode: 400},
+	{method: "DELETE", path: "/admin/webhooks/config-1", token: "alice-token", expCode: 409},
+	{method: "DELETE", path: "/admin/webhooks/unknown", token: "alice-token", expCode: 404},
+	{method: "POST", path: "/graphql", token: "alice-token", body: `{"query":"{ counts { total pending } }"}`, expCode: 200},
+	{method: "POST", path: "/graphql", token: "alice-token", body: `{"query":"mutation { addItem(task: \"\") { id } }"}`, expCode: 200},
+	{method: "POST", path: "/graphql", token: "alice-token", body: `{"query":"{ counts { total } }"}`, header: "Accept: text/event-stream", expCode: 200},
+	{method: "POST", path: "/graphql", token: "alice-token", body: `{"operationName":"x"}`, expCode: 400},
+	{method: "POST", path: "/graphql", body: `{"query":"{ counts { total } }"}`, expCode: 401},
+	{method: "GET", path: "/audit?actor=alice&since=2000-01-01T00:00:00Z", token: "alice-token", expCode: 200},
+	{method: "GET", path: "/audit?since=yesterday", token: "alice-token", expCode: 400},
+	{method: "GET", path: "/audit", token: "bob-token", expCode: 403},
+	{method: "GET", path: "/audit", expCode: 401},
+	{method: "GET", path: "/healthz", expCode: 200},
+	{method: "GET", path: "/readyz", expCode: 200},
+	{method: "GET", path: "/metrics", expCode: 200},
+	{method: "GET", path: "/openapi.json", expCode: 200},
+	{method: "PUT", path: "/todo/1", token: "alice-token", expCode: 405},
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	spec, err := loadOpenAPI(openAPIDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	users := userList{
+		{Name: "alice", Token: "alice-token", Admin: true},
+		{Name: "bob", Token: "bob-token"},
+	}
+	list := todo.NewList()
+	list.Add("Task 1")
+	list.Add("Task 2")
+	if err := list.Save(userFile(dir, "alice")); err != nil {
+		t.Fatal(err)
+	}
+	// The worker is not started, deliveries stay pending.
+	hooks, err := newWebhooks(webhookOptions{
+		endpoints: []webhook{{URL: "http://127.0.0.1:1/hook", Secret: "s3cret"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := openAuditLog(dir + "/audit.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(newMux(config{todoFile: dir + "/shared.json", dataDir: dir, users: users, webhooks: hooks,
+		audit: audit, idempotencyWindow: time.Minute}))
+	defer ts.Close()
+
+	// Form posts answer with redirects, which are checked as they are.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	covered := map[string]bool{}
+	for _, tc := range contractCases {
+		t.Run(tc.method+" "+tc.path+" "+strconv.Itoa(tc.expCode), func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.body != "" {
+				ct := tc.contentType
+				if ct == "" {
+					ct = "application/json"
+				}
+				req.Header.Set("Content-Type", ct)
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			if name, value, ok := strings.Cut(tc.header, ": "); ok {
+				req.Header.Set(name, value)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body []byte
+			// Streams never end, their events are checked in TestEvents.
+			if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				body, err = io.ReadAll(resp.Body)
+			}
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.expCode {
+				t.Fatalf("Expected status: %d, got %d: %s", tc.expCode, resp.StatusCode, body)
+			}
+
+			rt, found := spec.find(tc.method, req.URL.Path)
+			if !found {
+				t.Fatalf("Path %s is served but not in the spec", req.URL.Path)
+			}
+			if rt.op == nil {
+				if resp.StatusCode != http.StatusMethodNotAllowed {
+					t.Fatalf("%s %s is not in the spec but answered %d", tc.method, rt.template, resp.StatusCode)
+				}
+				return
+			}
+			covered[rt.op.OperationID] = true
+
+			doc, ok := rt.op.Responses[strconv.Itoa(resp.StatusCode)]
+			if !ok {
+				t.Fatalf("Status %d is not documented for %s", resp.StatusCode, rt.op.OperationID)
+			}
+			if len(doc.Content) == 0 {
+				if len(body) != 0 {
+					t.Errorf("Expected empty body, got %q", body)
+				}
+				return
+			}
+			ct, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			mt, ok := doc.Content[ct]
+			if !ok {
+				t.Fatalf("Content-Type %s is not documented for %s %d", ct, rt.op.OperationID, resp.StatusCode)
+			}
+			if ct != "application/json" {
+				return
+			}
+			if len(body) == 0 {
+				t.Fatal("Expected JSON body, got none")
+			}
+			var v any
+			if err := json.Unmarshal(body, &v); err != nil {
+				t.Fatal(err)
+			}
+			if err := spec.validate(mt.Schema, v, "response"); err != nil {
+				t.Errorf("Response does not match the spec: %s", err)
+			}
+		})
+	}
+
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			if !covered[op.OperationID] {
+				t.Errorf("%s %s (%s) has no contract case", strings.ToUpper(method), path, op.OperationID)
+			}
+		}
+	}
+}
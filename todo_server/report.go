@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+const (
+	// reportSince is the period of a report without ?since=.
+	reportSince = "7d"
+	// Report template file names, built in and in -report-templates.
+	reportMarkdownFile = "report.md.tmpl"
+	reportHTMLFile     = "report.html.tmpl"
+)
+
+// reportFormats are the formats of GET /todo/report.
+var reportFormats = []string{formatMarkdown, formatHTML}
+
+// defaultReports are the built-in report templates.
+var defaultReports = &reportTemplates{
+	markdown: template.Must(template.ParseFS(templateFiles, "templates/"+reportMarkdownFile)),
+	html:     htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/"+reportHTMLFile)),
+}
+
+// reportTemplates render a todo.Report as Markdown and HTML.
+type reportTemplates struct {
+	markdown *template.Template
+	html     *htmltemplate.Template
+}
+
+// loadReportTemplates reads report.md.tmpl and report.html.tmpl from dir.
+// A missing file keeps the built-in template, an empty dir keeps both.
+func loadReportTemplates(dir string) (*reportTemplates, error) {
+	if dir == "" {
+		return defaultReports, nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("report templates: %w", err)
+	}
+	rt := *defaultReports
+	file := filepath.Join(dir, reportMarkdownFile)
+	if _, err := os.Stat(file); err == nil {
+		if rt.markdown, err = template.ParseFiles(file); err != nil {
+			return nil, fmt.Errorf("report templates: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("report templates: %w", err)
+	}
+	file = filepath.Join(dir, reportHTMLFile)
+	if _, err := os.Stat(file); err == nil {
+		if rt.html, err = htmltemplate.ParseFiles(file); err != nil {
+			return nil, fmt.Errorf("report templates: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("report templates: %w", err)
+	}
+	return &rt, nil
+}
+
+// execute writes report in format. A nil rt uses the built-in templates.
+func (rt *reportTemplates) execute(w io.Writer, format string, report todo.Report) error {
+	if rt == nil {
+		rt = defaultReports
+	}
+	if format == formatHTML {
+		return rt.html.Execute(w, report)
+	}
+	return rt.markdown.Execute(w, report)
+}
+
+// parseSince returns the start of a report period ending at now: a
+// number of days ("7d") or weeks ("2w"), a Go duration ("36h") or a date
+// ("2026-10-12", midnight on the server).
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, now.Location()); err == nil {
+		if !t.Before(now) {
+			return time.Time{}, fmt.Errorf("%w: since %q is not in the past", ErrInvalidData, s)
+		}
+		return t, nil
+	}
+	var d time.Duration
+	unit := 0
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 1
+	case strings.HasSuffix(s, "w"):
+		unit = 7
+	}
+	if unit > 0 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: since %q", ErrInvalidData, s)
+		}
+		day := time.Duration(unit) * 24 * time.Hour
+		if n > int(math.MaxInt64/day) {
+			return time.Time{}, fmt.Errorf("%w: since %q is too long ago", ErrInvalidData, s)
+		}
+		d = time.Duration(n) * day
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return time.Time{}, fmt.Errorf("%w: since %q", ErrInvalidData, s)
+		}
+	}
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("%w: since %q is not in the past", ErrInvalidData, s)
+	}
+	return now.Add(-d), nil
+}
+
+// reportHandler serves GET /todo/report, the report of the list for the
+// period in ?since= as Markdown or HTML.
+func reportHandler(w http.ResponseWriter, r *http.Request, list *todo.List, reports *reportTemplates) {
+	if r.Method != http.MethodGet {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	format, ok := negotiate(w, r, reportFormats)
+	if !ok {
+		replyNotAcceptable(w, r, reportFormats)
+		return
+	}
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = reportSince
+	}
+	now := time.Now()
+	start, err := parseSince(since, now)
+	if err != nil {
+		replyErrorContent(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	var body bytes.Buffer
+	if err := reports.execute(&body, format, list.Report(start, now)); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", formatTypes[format][0]+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
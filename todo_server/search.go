@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// searchResult is an item found by GET /todo/search. Matches are the
+// byte ranges of the task that matched the query.
+type searchResult struct {
+	ID      int          `json:"id"`
+	Task    string       `json:"task"`
+	Done    bool         `json:"done"`
+	Score   float64      `json:"score"`
+	Matches []matchRange `json:"matches"`
+}
+
+type matchRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// search runs query against the index of list, rebuilding the index
+// when the list file changed behind the store's back.
+func (st *store) search(list *todo.List, query string) []todo.Match {
+	if st.index == nil || !st.indexTime.Equal(st.modTime()) || st.index.Len() != len(*list) {
+		st.index, st.indexTime = todo.NewIndex(*list), st.modTime()
+	}
+	return st.index.Search(query)
+}
+
+// reindex applies events to the index after the list they changed was
+// saved. The index is dropped when it did not reflect the list saved at
+// prev, and rebuilt by the next search.
+func (st *store) reindex(prev time.Time, events []event) {
+	if st.index == nil {
+		return
+	}
+	if !st.indexTime.Equal(prev) {
+		st.index = nil
+		return
+	}
+	for _, e := range events {
+		if err := indexEvent(st.index, e); err != nil {
+			st.index = nil
+			return
+		}
+	}
+	st.indexTime = st.modTime()
+}
+
+// indexEvent makes the change of e to the index.
+func indexEvent(x *todo.Index, e event) error {
+	it, _ := e.item()
+	switch e.Type {
+	case eventAdded, eventRestored:
+		return x.Insert(e.Position, it.Task)
+	case eventEdited:
+		return x.Edit(e.Position, it.Task)
+	case eventDeleted:
+		return x.Delete(e.Position)
+	case eventReordered:
+		return x.Move(e.Position, e.To)
+	}
+	return nil
+}
+
+// searchHandler serves GET /todo/search?q=, best matches first.
+func searchHandler(w http.ResponseWriter, r *http.Request, list *todo.List, st *store) {
+	if r.Method != http.MethodGet {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("%s: missing query parameter 'q'", ErrInvalidData))
+		return
+	}
+	results := []searchResult{}
+	for _, m := range st.search(list, q) {
+		res := searchResult{ID: m.ID, Task: m.Task, Done: (*list)[m.ID-1].Done, Score: m.Score}
+		for _, rg := range m.Ranges {
+			res.Matches = append(res.Matches, matchRange{rg.Start, rg.End})
+		}
+		results = append(results, res)
+	}
+	replyResults(w, r, results, len(results))
+}
@@ -1,23 +1,149 @@
 package main
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
-func newMux(f string) http.Handler {
+// config holds the server settings. With no users the server runs in
+// single-user mode and keeps every task in todoFile. Zero limits are
+// disabled.
+type config struct {
+	todoFile string
+	dataDir  string
+	users    userList
+
+	rateLimit float64
+	rateBurst int
+	maxBody   int64
+	limits    limits
+
+	// idempotencyWindow is how long POST responses are kept for replay
+	// by Idempotency-Key.
+	idempotencyWindow time.Duration
+
+	// corsOrigins may call the API from a browser, "*" is any origin.
+	corsOrigins []string
+
+	// webhooks is nil when none is configured and none can be
+	// registered, that is without a users file.
+	webhooks *webhooks
+
+	// audit is nil when changes are not audited.
+	audit *auditLog
+
+	// trashDays is how long deleted items can be restored, 0 is forever.
+	trashDays int
+
+	// reports render GET /todo/report, nil uses the built-in templates.
+	reports *reportTemplates
+
+	logger *slog.Logger
+}
+
+// limits restricts what a single list may hold.
+type limits struct {
+	maxTaskLen int
+	maxItems   int
+}
+
+// app holds the state shared by the handlers of one server.
+type app struct {
+	cfg      config
+	stores   *storeSet
+	metrics  *metrics
+	logger   *slog.Logger
+	spec     *openAPISpec
+	draining atomic.Bool
+}
+
+func newApp(cfg config) *app {
+	met := newMetrics()
+	logger := cfg.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	spec, err := loadOpenAPI(openAPIDocument)
+	if err != nil {
+		panic(fmt.Sprintf("embedded openapi.json: %s", err))
+	}
+	return &app{
+		cfg:     cfg,
+		stores:  newStoreSet(cfg.todoFile, cfg.dataDir, met, cfg.webhooks, cfg.audit, cfg.trashDays),
+		metrics: met,
+		logger:  logger,
+		spec:    spec,
+	}
+}
+
+func newMux(cfg config) http.Handler {
+	return newApp(cfg).routes()
+}
+
+func (a *app) routes() http.Handler {
 	m := http.NewServeMux()
-	mutex := &sync.Mutex{}
+	cfg := a.cfg
+
+	// Requests are checked against the OpenAPI spec only once the caller
+	// is known, so anonymous callers get 401 before any validation error
+	// and their bodies are not parsed.
+	validate := validateRequests(a.spec)
+	protect := func(h http.Handler, admin bool) http.Handler {
+		h = validate(h)
+		if cfg.users == nil {
+			return h
+		}
+		if admin {
+			h = requireAdmin(h)
+		}
+		return authenticate(cfg.users, h)
+	}
+
+	m.Handle("/", validate(http.HandlerFunc(rootHandler)))
+	m.Handle("/metrics", validate(metricsHandler(a.metrics)))
+	m.Handle("/healthz", validate(http.HandlerFunc(healthHandler)))
+	m.Handle("/readyz", validate(readyHandler(a)))
+	m.Handle("/openapi.json", validate(http.HandlerFunc(openAPIHandler)))
+	m.Handle("/ui/", validate(uiHandler()))
 
-	m.HandleFunc("/", rootHandler)
+	var handler http.Handler = todoRouter(a.stores, cfg.limits, newHTMLView(), cfg.reports)
+	handler = idempotent(cfg.idempotencyWindow)(handler)
+	if cfg.users != nil {
+		m.Handle("/admin/users", protect(adminUsersHandler(cfg.users, a.stores), true))
+		if cfg.audit != nil {
+			m.Handle("/audit", protect(auditHandler(cfg.audit), true))
+		}
+		if cfg.webhooks != nil {
+			hooks := protect(adminWebhooksHandler(cfg.webhooks), true)
+			m.Handle("/admin/webhooks", hooks)
+			m.Handle("/admin/webhooks/", hooks)
+		}
+	}
 
-	handler := todoRouter(f, mutex)
+	if cfg.users == nil && cfg.webhooks != nil {
+		// Without users there is no admin: the webhooks and the delivery
+		// log can be read by anyone, like /metrics.
+		hooks := readOnly(validate(adminWebhooksHandler(cfg.webhooks)))
+		m.Handle("/admin/webhooks", hooks)
+		m.Handle("/admin/webhooks/", hooks)
+	}
 
-	m.Handle("/todo", http.StripPrefix("/todo", handler))
-	m.Handle("/todo/", http.StripPrefix("/todo/", handler))
+	m.Handle("/graphql", protect(graphqlHandler(newGraphQLSchema(a.stores, cfg.limits)), false))
+	m.Handle("/todo", protect(http.StripPrefix("/todo", handler), false))
+	m.Handle("/todo/", protect(http.StripPrefix("/todo/", handler), false))
 
-	return m
+	return chain(m,
+		accessLog(a.logger),
+		instrument(a.metrics),
+		cors(cfg.corsOrigins),
+		compress(),
+		rateLimit(cfg.rateLimit, cfg.rateBurst, cfg.users),
+		limitBody(cfg.maxBody),
+	)
 }
 
 func replyTextContent(w http.ResponseWriter, r *http.Request, status int, content string) {
@@ -37,8 +163,31 @@ func replyJSONContent(w http.ResponseWriter, r *http.Request, status int, resp *
 	w.Write(body)
 }
 
+func replyJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// replyResults wraps results in the envelope the list endpoints share.
+func replyResults(w http.ResponseWriter, r *http.Request, results any, total int) {
+	replyJSON(w, r, http.StatusOK, struct {
+		Results      any `json:"results"`
+		TotalResults int `json:"total_results"`
+	}{results, total})
+}
+
 func replyErrorContent(w http.ResponseWriter, r *http.Request, status int, err string) {
-	log.Printf("%s, %s: Error: %d %s", r.URL, r.Method, status, err)
+	level := slog.LevelWarn
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	requestLogger(r).Log(r.Context(), level, "request failed",
+		"url", r.URL.String(), "method", r.Method, "status", status, "error", err)
 	http.Error(w, http.StatusText(status), status)
-
 }
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 
 	"pragprog.com/rggo/interacting/todo"
 )
@@ -23,6 +38,11 @@ var res struct {
 
 func setUpAPI(t *testing.T, listInit bool) (string, func()) {
 	t.Helper()
+	return setUpAPIConfig(t, listInit, config{})
+}
+
+func setUpAPIConfig(t *testing.T, listInit bool, cfg config) (string, func()) {
+	t.Helper()
 
 	tempFile, err := os.CreateTemp(".", "temp_todo.json")
 	if err != nil {
@@ -36,11 +56,13 @@ func setUpAPI(t *testing.T, listInit bool) (string, func()) {
 	}
 	list.Save(tempFile.Name())
 
-	testS := httptest.NewServer(newMux(tempFile.Name()))
+	cfg.todoFile = tempFile.Name()
+	testS := httptest.NewServer(newMux(cfg))
 
 	return testS.URL, func() {
 		testS.Close()
 		os.Remove(tempFile.Name())
+		os.Remove((&store{file: tempFile.Name()}).trashFile())
 	}
 
 }
@@ -60,7 +82,7 @@ func TestGet(t *testing.T) {
 		{name: "Get root",
 			path:       "/",
 			expCode:    http.StatusOK,
-			expContent: "There is rootHandler response",
+			expContent: "Todo API",
 		},
 		{name: "Get all",
 			path:       "/todo",
@@ -301,3 +323,2165 @@ func TestComplete(t *testing.T) {
 		}
 	})
 }
+
+func TestMultiUser(t *testing.T) {
+	dir := t.TempDir()
+	users := userList{
+		{Name: "alice", Token: "alice-token", Admin: true},
+		{Name: "bob", Token: "bob-token"},
+	}
+	shared := dir + "/shared.json"
+	list := todo.NewList()
+	list.Add("Shared task")
+	if err := list.Save(shared); err != nil {
+		t.Fatal(err)
+	}
+	stores := newStoreSet(shared, dir, nil, nil, nil, 0)
+	if err := migrateShared(shared, stores, users, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateShared(shared, stores, users, "alice"); err == nil {
+		t.Error("Expected error migrating twice, got nil")
+	}
+
+	ts := httptest.NewServer(newMux(config{todoFile: shared, dataDir: dir, users: users}))
+	defer ts.Close()
+
+	do := func(method, path, token string, body io.Reader) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("No token", func(t *testing.T) {
+		r := do(http.MethodGet, "/todo", "", nil)
+		if r.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status: %d, got %d", http.StatusUnauthorized, r.StatusCode)
+		}
+	})
+
+	t.Run("Basic auth", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/todo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "text/html")
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if h := r.Header.Get("WWW-Authenticate"); r.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(h, "Basic ") {
+			t.Fatalf("Expected Basic challenge, got %d %q", r.StatusCode, h)
+		}
+		req.SetBasicAuth("bob", "bob-token")
+		r, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			t.Errorf("Expected status: %d, got %d", http.StatusOK, r.StatusCode)
+		}
+	})
+
+	t.Run("Separate lists", func(t *testing.T) {
+		r := do(http.MethodPost, "/todo", "bob-token", strings.NewReader(`{"task":"Bob task"}`))
+		if r.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status: %d, got %d", http.StatusCreated, r.StatusCode)
+		}
+		for token, exp := range map[string]string{"alice-token": "Shared task", "bob-token": "Bob task"} {
+			var resp todoResponse
+			r := do(http.MethodGet, "/todo", token, nil)
+			if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Results) != 1 || resp.Results[0].Task != exp {
+				t.Errorf("Expected only %q for %s, got %v", exp, token, resp.Results)
+			}
+		}
+	})
+
+	t.Run("Admin users", func(t *testing.T) {
+		if r := do(http.MethodGet, "/admin/users", "bob-token", nil); r.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status: %d, got %d", http.StatusForbidden, r.StatusCode)
+		}
+		r := do(http.MethodGet, "/admin/users", "alice-token", nil)
+		var resp struct {
+			Results []userUsage `json:"results"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Results) != 2 {
+			t.Fatalf("Expected 2 users, got %d", len(resp.Results))
+		}
+		if resp.Results[1].Name != "bob" || resp.Results[1].Items != 1 {
+			t.Errorf("Expected bob with 1 item, got %+v", resp.Results[1])
+		}
+	})
+}
+
+func TestLimits(t *testing.T) {
+	url, cleanUp := setUpAPIConfig(t, true, config{
+		maxBody: 64,
+		limits:  limits{maxTaskLen: 10, maxItems: 3},
+	})
+	defer cleanUp()
+
+	testCases := []struct {
+		name    string
+		body    string
+		expCode int
+	}{
+		{name: "Body too large", body: `{"task":"` + strings.Repeat("x", 100) + `"}`,
+			expCode: http.StatusRequestEntityTooLarge},
+		{name: "Task too long", body: `{"task":"Task is too long"}`, expCode: http.StatusBadRequest},
+		{name: "Fits", body: `{"task":"Task 3"}`, expCode: http.StatusCreated},
+		{name: "List full", body: `{"task":"Task 4"}`, expCode: http.StatusConflict},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.Post(url+"/todo", "application/json", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+			if r.StatusCode != tc.expCode {
+				t.Errorf("Expected status: %d, got %d", tc.expCode, r.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	url, cleanUp := setUpAPIConfig(t, true, config{rateLimit: 1, rateBurst: 2})
+	defer cleanUp()
+
+	for i, exp := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		r, err := http.Get(url + "/todo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != exp {
+			t.Errorf("Request %d: expected status: %d, got %d", i+1, exp, r.StatusCode)
+		}
+		if exp == http.StatusTooManyRequests && r.Header.Get("Retry-After") != "1" {
+			t.Errorf("Expected Retry-After 1, got %q", r.Header.Get("Retry-After"))
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := newLogger(&logs, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, cleanUp := setUpAPIConfig(t, true, config{logger: logger})
+	defer cleanUp()
+
+	req, err := http.NewRequest(http.MethodGet, url+"/todo/5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(requestIDHeader, "test-id-1")
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if got := r.Header.Get(requestIDHeader); got != "test-id-1" {
+		t.Errorf("Expected request ID test-id-1, got %q", got)
+	}
+
+	var entries []map[string]any
+	dec := json.NewDecoder(&logs)
+	for dec.More() {
+		e := map[string]any{}
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 log entries, got %d", len(entries))
+	}
+	if entries[0]["msg"] != "request failed" || entries[0]["request_id"] != "test-id-1" {
+		t.Errorf("Expected error entry with request ID, got %v", entries[0])
+	}
+	access := entries[1]
+	if access["msg"] != "request" || access["request_id"] != "test-id-1" {
+		t.Errorf("Expected access entry with request ID, got %v", access)
+	}
+	if access["status"] != float64(http.StatusNotFound) || access["path"] != "/todo/5" {
+		t.Errorf("Expected 404 for /todo/5, got %v %v", access["status"], access["path"])
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	for _, path := range []string{"/todo", "/todo/1", "/todo/9"} {
+		r, err := http.Get(url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	r, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expLines := []string{
+		`todo_http_requests_total{route="/todo",method="GET",status="200"} 1`,
+		`todo_http_requests_total{route="/todo/{id}",method="GET",status="200"} 1`,
+		`todo_http_requests_total{route="/todo/{id}",method="GET",status="404"} 1`,
+		`todo_http_request_duration_seconds_count{route="/todo",method="GET",status="200"} 1`,
+		`todo_storage_load_duration_seconds_count 3`,
+		`todo_storage_errors_total{op="save"} 0`,
+		`todo_lock_wait_seconds_count 3`,
+		`todo_items 2`,
+		`todo_items_completed 0`,
+	}
+	for _, exp := range expLines {
+		if !strings.Contains(string(body), exp+"\n") {
+			t.Errorf("Expected metrics to contain %q", exp)
+		}
+	}
+}
+
+func TestRouteOf(t *testing.T) {
+	testCases := []struct {
+		path string
+		exp  string
+	}{
+		{path: "/todo", exp: "/todo"},
+		{path: "/todo/3", exp: "/todo/{id}"},
+		{path: "/todo/trash", exp: "/todo/trash"},
+		{path: "/todo/trash/2/restore", exp: "/todo/trash/{id}/restore"},
+		{path: "/todo/search", exp: "/todo/search"},
+		{path: "/todo/stats", exp: "/todo/stats"},
+		{path: "/todo/charts/burndown.svg", exp: "/todo/charts/{name}.svg"},
+		{path: "/todo/report", exp: "/todo/report"},
+		{path: "/todo/timer", exp: "/todo/timer"},
+		{path: "/todo/timesheet", exp: "/todo/timesheet"},
+		{path: "/admin/webhooks/abc", exp: "/admin/webhooks/{id}"},
+		{path: "/nowhere", exp: "other"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if got := routeOf(tc.path); got != tc.exp {
+				t.Errorf("Expected route %q, got %q", tc.exp, got)
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	tempFile, err := os.CreateTemp(t.TempDir(), "todo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempFile.Close()
+	a := newApp(config{todoFile: tempFile.Name()})
+	ts := httptest.NewServer(a.routes())
+	defer ts.Close()
+
+	check := func(path string, exp int) {
+		t.Helper()
+		r, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != exp {
+			t.Errorf("%s: expected status: %d, got %d", path, exp, r.StatusCode)
+		}
+	}
+
+	check("/healthz", http.StatusOK)
+	check("/readyz", http.StatusOK)
+
+	if err := os.WriteFile(tempFile.Name(), []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check("/readyz", http.StatusServiceUnavailable)
+
+	if err := os.WriteFile(tempFile.Name(), []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a.draining.Store(true)
+	check("/healthz", http.StatusOK)
+	check("/readyz", http.StatusServiceUnavailable)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, err := selfSignedCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := dir + "/ca.pem"
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsCfg, err := serverTLSConfig(tlsOptions{selfSigned: true, clientCA: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(newMux(config{todoFile: dir + "/todo.json"}))
+	ts.TLS = tlsCfg
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsCfg.Certificates[0].Leaf)
+
+	testCases := []struct {
+		name   string
+		certs  []tls.Certificate
+		expErr bool
+	}{
+		{name: "Without client certificate", expErr: true},
+		{name: "With client certificate", certs: []tls.Certificate{clientCert}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: tc.certs},
+			}}
+			r, err := c.Get(ts.URL + "/healthz")
+			if tc.expErr {
+				if err == nil {
+					r.Body.Close()
+					t.Fatal("Expected TLS handshake error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+			if r.StatusCode != http.StatusOK {
+				t.Errorf("Expected status: %d, got %d", http.StatusOK, r.StatusCode)
+			}
+		})
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	configFile := t.TempDir() + "/todo_server.yaml"
+	content := "listen:\n  port: 9000\n  host: 0.0.0.0\nlimits:\n  rate: 3\n  burst: 4\n"
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TODO_SERVER_LISTEN_PORT", "9100")
+	t.Setenv("TODO_SERVER_LIMITS_BURST", "5")
+	t.Setenv("TODO_SERVER_TIMEOUTS_READ", "3s")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	defineFlags(fs)
+	if err := fs.Parse([]string{"-p", "9200", "-max-items", "7", "-cors-origins", "http://a.example,http://b.example"}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadSettings(fs, configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		got  any
+		exp  any
+	}{
+		{name: "Flag over env", got: s.Listen.Port, exp: 9200},
+		{name: "Env over file", got: s.Limits.Burst, exp: 5},
+		{name: "File over default", got: s.Listen.Host, exp: "0.0.0.0"},
+		{name: "File", got: s.Limits.Rate, exp: 3.0},
+		{name: "Flag", got: s.Limits.MaxItems, exp: 7},
+		{name: "Env duration", got: s.Timeouts.Read, exp: 3 * time.Second},
+		{name: "Default", got: s.Timeouts.Write, exp: 10 * time.Second},
+		{name: "Flag list", got: fmt.Sprint(s.CORS.AllowedOrigins), exp: "[http://a.example http://b.example]"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.got != tc.exp {
+				t.Errorf("Expected %v, got %v", tc.exp, tc.got)
+			}
+		})
+	}
+
+	t.Run("Opt-in defaults", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		defineFlags(fs)
+		d, err := loadSettings(fs, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Limits.Rate != 0 || d.Audit.File != "" {
+			t.Errorf("Expected rate limiting and auditing off, got rate %v and audit file %q", d.Limits.Rate, d.Audit.File)
+		}
+	})
+
+	t.Run("Print", func(t *testing.T) {
+		s.Webhooks.Endpoints = []endpointEntry{{URL: "http://hooks.example", Secret: "s3cret"}}
+		var out bytes.Buffer
+		if err := printSettings(&out, s); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "port: 9200\n") || !strings.Contains(out.String(), "read: 3s\n") {
+			t.Errorf("Unexpected config dump:\n%s", out.String())
+		}
+		if strings.Contains(out.String(), "s3cret") || !strings.Contains(out.String(), "secret: REDACTED\n") {
+			t.Errorf("Expected the webhook secret redacted:\n%s", out.String())
+		}
+		if s.Webhooks.Endpoints[0].Secret != "s3cret" {
+			t.Error("Expected the settings left unchanged")
+		}
+	})
+}
+
+func TestEvents(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	type sse struct {
+		id, name, data string
+	}
+	// stream connects to the change stream and sends the events it
+	// receives on the returned channel.
+	stream := func(lastID string) (<-chan sse, func()) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url+"/todo/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Expected content type text/event-stream, got %q", ct)
+		}
+		ch := make(chan sse, 10)
+		go func() {
+			defer close(ch)
+			var e sse
+			s := bufio.NewScanner(r.Body)
+			for s.Scan() {
+				field, value, _ := strings.Cut(s.Text(), ": ")
+				switch field {
+				case "id":
+					e.id = value
+				case "event":
+					e.name = value
+				case "data":
+					e.data = value
+				case "":
+					if e.name != "" {
+						ch <- e
+					}
+					e = sse{}
+				}
+			}
+		}()
+		return ch, func() { r.Body.Close() }
+	}
+	next := func(ch <-chan sse) sse {
+		t.Helper()
+		select {
+		case e := <-ch:
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for event")
+		}
+		return sse{}
+	}
+	patch := func(path, body string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPatch, url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %q, got %q", http.StatusText(http.StatusOK), http.StatusText(r.StatusCode))
+		}
+	}
+
+	events, stop := stream("")
+	patch("/todo/1?complete", "")
+	patch("/todo/2", `{"task":"Renamed task"}`)
+	patch("/todo/2?move=1", "")
+
+	var e sse
+	for _, exp := range []string{eventCompleted, eventEdited, eventReordered} {
+		e = next(events)
+		if e.name != exp {
+			t.Fatalf("Expected event %q, got %q", exp, e.name)
+		}
+	}
+	var ev struct {
+		Type     string
+		Position int
+		To       int
+	}
+	if err := json.Unmarshal([]byte(e.data), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Type != eventReordered || ev.Position != 2 || ev.To != 1 {
+		t.Errorf("Unexpected reorder event %+v", ev)
+	}
+	stop()
+
+	t.Run("Resume", func(t *testing.T) {
+		r, err := http.Post(url+"/todo", "application/json", strings.NewReader(`{"task":"Task 3"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+
+		events, stop := stream(e.id)
+		defer stop()
+		if got := next(events); got.name != eventAdded {
+			t.Errorf("Expected event %q, got %q", eventAdded, got.name)
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		events, stop := stream("1")
+		defer stop()
+		if got := next(events); got.name != eventReset {
+			t.Errorf("Expected event %q, got %q", eventReset, got.name)
+		}
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	type call struct {
+		header http.Header
+		body   []byte
+	}
+	calls := make(chan call, 10)
+	var failures atomic.Int32
+	failures.Store(1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		calls <- call{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	queueFile := filepath.Join(t.TempDir(), "webhooks.json")
+	opts := webhookOptions{
+		file:        queueFile,
+		maxAttempts: 3,
+		backoff:     10 * time.Millisecond,
+		endpoints:   []webhook{{URL: receiver.URL, Secret: "s3cret", Events: []string{eventAdded}}},
+	}
+	hooks, err := newWebhooks(opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks.start()
+	defer hooks.stop()
+
+	url, cleanUp := setUpAPIConfig(t, false, config{webhooks: hooks})
+	defer cleanUp()
+
+	next := func() call {
+		t.Helper()
+		select {
+		case c := <-calls:
+			return c
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timeout waiting for delivery")
+		}
+		return call{}
+	}
+
+	r, err := http.Post(url+"/todo", "application/json", strings.NewReader(`{"task":"Hooked task"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	// Completing is not subscribed to and must not be delivered.
+	req, _ := http.NewRequest(http.MethodPatch, url+"/todo/1?complete", nil)
+	r, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+
+	first, retried := next(), next()
+	if first.header.Get(webhookDeliveryHeader) != retried.header.Get(webhookDeliveryHeader) {
+		t.Error("Expected the retry to reuse the delivery ID")
+	}
+	if ev := retried.header.Get(webhookEventHeader); ev != eventAdded {
+		t.Errorf("Expected event %q, got %q", eventAdded, ev)
+	}
+	if sig := retried.header.Get(webhookSignatureHeader); sig != signPayload("s3cret", retried.body) {
+		t.Errorf("Bad signature %q", sig)
+	}
+	var payload struct {
+		Event string
+		Data  struct{ Item struct{ Task string } }
+	}
+	if err := json.Unmarshal(retried.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != eventAdded || payload.Data.Item.Task != "Hooked task" {
+		t.Errorf("Unexpected payload %s", retried.body)
+	}
+	select {
+	case c := <-calls:
+		t.Errorf("Unexpected delivery of %s", c.header.Get(webhookEventHeader))
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	log := hooks.deliveries("", "")
+	if len(log) != 1 || log[0].Status != deliveryDelivered || log[0].Attempts != 2 {
+		t.Errorf("Unexpected delivery log %+v", log)
+	}
+
+	t.Run("Restart", func(t *testing.T) {
+		opts := opts
+		opts.file = filepath.Join(t.TempDir(), "webhooks.json")
+		stopped, err := newWebhooks(opts, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stopped.notify("alice", event{ID: 7, Type: eventAdded})
+		// The worker writes the queue before sending, so a crash then
+		// leaves the delivery pending.
+		stopped.persist()
+
+		restarted, err := newWebhooks(opts, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restarted.start()
+		defer restarted.stop()
+		c := next()
+		if !bytes.Contains(c.body, []byte(`"user":"alice"`)) {
+			t.Errorf("Expected queued delivery for alice, got %s", c.body)
+		}
+	})
+
+	t.Run("Single user", func(t *testing.T) {
+		r, err := http.Get(url + "/admin/webhooks/deliveries?status=delivered")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		var resp struct {
+			Results []delivery `json:"results"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if r.StatusCode != http.StatusOK || len(resp.Results) == 0 {
+			t.Errorf("Expected the delivery log without a token, got %s and %+v", r.Status, resp.Results)
+		}
+		post, err := http.Post(url+"/admin/webhooks", "application/json", strings.NewReader(`{"url":"http://x.example","secret":"s"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		post.Body.Close()
+		if post.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Expected registration refused without users, got %s", post.Status)
+		}
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "webhooks.json")
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		defineFlags(fs)
+		if err := fs.Parse([]string{"-webhooks-file", file}); err != nil {
+			t.Fatal(err)
+		}
+		s, err := loadSettings(fs, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := newConfig(s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.webhooks != nil {
+			t.Error("Expected no webhooks without configured ones or users")
+		}
+	})
+
+	t.Run("Stop during delivery", func(t *testing.T) {
+		release := make(chan struct{})
+		hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer hanging.Close()
+		defer close(release)
+
+		opts := webhookOptions{
+			file:        filepath.Join(t.TempDir(), "webhooks.json"),
+			maxAttempts: 3,
+			timeout:     time.Minute,
+			endpoints:   []webhook{{URL: hanging.URL, Secret: "s3cret"}},
+		}
+		slow, err := newWebhooks(opts, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slow.start()
+		slow.notify("", event{Type: eventAdded})
+		slow.notify("", event{Type: eventCompleted})
+		time.Sleep(20 * time.Millisecond)
+
+		start := time.Now()
+		slow.stop()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected stop to abort the delivery, took %s", elapsed)
+		}
+		pending := slow.deliveries("", deliveryPending)
+		if len(pending) != 2 || pending[0].Attempts != 0 || pending[1].Attempts != 0 {
+			t.Errorf("Expected both deliveries pending without attempts, got %+v", pending)
+		}
+	})
+
+	t.Run("No webhooks", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "webhooks.json")
+		idle, err := newWebhooks(webhookOptions{file: file}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idle.start()
+		idle.notify("", event{Type: eventAdded})
+		idle.stop()
+		if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected no queue file without webhooks, got %v", err)
+		}
+	})
+
+	t.Run("Give up", func(t *testing.T) {
+		failures.Store(int32(opts.maxAttempts))
+		hooks.notify("", event{Type: eventAdded})
+		for range opts.maxAttempts {
+			next()
+		}
+		time.Sleep(20 * time.Millisecond)
+		failed := hooks.deliveries("config-1", deliveryFailed)
+		if len(failed) != 1 || failed[0].Attempts != opts.maxAttempts || failed[0].ResponseCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected one failed delivery, got %+v", failed)
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expCode  int
+		expIDs   []int
+		expTasks []string
+		expDone  []bool
+	}{
+		{name: "Mixed",
+			body: `{"operations":[
+				{"op":"delete","id":1},
+				{"op":"complete","id":2},
+				{"op":"add","task":"Test task 3"},
+				{"op":"edit","id":2,"task":"Renamed task 2"}]}`,
+			expCode:  http.StatusOK,
+			expIDs:   []int{1, 1, 2, 1},
+			expTasks: []string{"Renamed task 2", "Test task 3"},
+			expDone:  []bool{true, false},
+		},
+		{name: "Rollback",
+			body:     `{"operations":[{"op":"complete","id":1},{"op":"delete","id":5}]}`,
+			expCode:  http.StatusUnprocessableEntity,
+			expTasks: []string{"Test task 1", "Test task 2"},
+			expDone:  []bool{false, false},
+		},
+		{name: "DeletedTwice",
+			body:     `{"operations":[{"op":"delete","id":1},{"op":"delete","id":1}]}`,
+			expCode:  http.StatusUnprocessableEntity,
+			expTasks: []string{"Test task 1", "Test task 2"},
+			expDone:  []bool{false, false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := setUpAPI(t, true)
+			defer cleanUp()
+
+			r, err := http.Post(url+"/todo/batch", "application/json", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("Expected %q, got %q", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			var resp batchResponse
+			if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Applied != (tc.expCode == http.StatusOK) {
+				t.Errorf("Unexpected applied %t", resp.Applied)
+			}
+			for i, id := range tc.expIDs {
+				if resp.Results[i].ID != id || resp.Results[i].Status != batchApplied {
+					t.Errorf("Expected operation %d applied to %d, got %+v", i, id, resp.Results[i])
+				}
+			}
+			if !resp.Applied && resp.Results[len(resp.Results)-1].Status != batchFailed {
+				t.Errorf("Expected last operation to fail, got %+v", resp.Results)
+			}
+
+			r2, err := http.Get(url + "/todo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r2.Body.Close()
+			var all struct {
+				Results todo.List `json:"results"`
+			}
+			if err := json.NewDecoder(r2.Body).Decode(&all); err != nil {
+				t.Fatal(err)
+			}
+			list := all.Results
+			if len(list) != len(tc.expTasks) {
+				t.Fatalf("Expected %d items, got %d", len(tc.expTasks), len(list))
+			}
+			for i := range list {
+				if list[i].Task != tc.expTasks[i] || list[i].Done != tc.expDone[i] {
+					t.Errorf("Expected item %d %q done %t, got %q done %t",
+						i+1, tc.expTasks[i], tc.expDone[i], list[i].Task, list[i].Done)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	url, cleanUp := setUpAPIConfig(t, false, config{idempotencyWindow: time.Minute})
+	defer cleanUp()
+
+	post := func(path, key, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, r.Body)
+		r.Body.Close()
+		return r
+	}
+	count := func() int {
+		t.Helper()
+		r, err := http.Get(url + "/todo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		var resp struct {
+			TotalResults int `json:"total_results"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.TotalResults
+	}
+
+	testCases := []struct {
+		name      string
+		path      string
+		key       string
+		body      string
+		expCode   int
+		expReplay bool
+		expItems  int
+	}{
+		{name: "First", path: "/todo", key: "add-1", body: `{"task":"Task 1"}`,
+			expCode: http.StatusCreated, expItems: 1},
+		{name: "Retry", path: "/todo", key: "add-1", body: `{"task":"Task 1"}`,
+			expCode: http.StatusCreated, expReplay: true, expItems: 1},
+		{name: "Other request", path: "/todo", key: "add-1", body: `{"task":"Task 2"}`,
+			expCode: http.StatusUnprocessableEntity, expItems: 1},
+		{name: "Batch", path: "/todo/batch", key: "batch-1", body: `{"operations":[{"op":"add","task":"Task 2"}]}`,
+			expCode: http.StatusOK, expItems: 2},
+		{name: "Batch retry", path: "/todo/batch", key: "batch-1", body: `{"operations":[{"op":"add","task":"Task 2"}]}`,
+			expCode: http.StatusOK, expReplay: true, expItems: 2},
+		{name: "No key", path: "/todo", body: `{"task":"Task 1"}`,
+			expCode: http.StatusCreated, expItems: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := post(tc.path, tc.key, tc.body)
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("Expected %q, got %q", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if replay := r.Header.Get(idempotentReplayHeader) == "true"; replay != tc.expReplay {
+				t.Errorf("Expected replayed %t, got %t", tc.expReplay, replay)
+			}
+			if n := count(); n != tc.expItems {
+				t.Errorf("Expected %d items, got %d", tc.expItems, n)
+			}
+		})
+	}
+
+	t.Run("Body too large", func(t *testing.T) {
+		h := idempotent(time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Expected the request stopped before the handler")
+		}))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/todo", strings.NewReader(`{"task":"Too long"}`))
+		req.Header.Set(idempotencyKeyHeader, "big-1")
+		req.Body = http.MaxBytesReader(w, req.Body, 4)
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected %q, got %q", http.StatusText(http.StatusRequestEntityTooLarge), http.StatusText(w.Code))
+		}
+	})
+}
+
+func TestUI(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	noRedirect := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	testCases := []struct {
+		name       string
+		path       string
+		accept     string
+		expCode    int
+		expType    string
+		expContent string
+	}{
+		{name: "Browser root", path: "/", accept: "text/html,application/xhtml+xml",
+			expCode: http.StatusFound},
+		{name: "Index", path: "/ui/", expCode: http.StatusOK,
+			expType: "text/html", expContent: "<title>Todo</title>"},
+		{name: "Script", path: "/ui/app.js", expCode: http.StatusOK,
+			expType: "text/javascript", expContent: "/todo"},
+		{name: "Missing", path: "/ui/missing.js", expCode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, url+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			r, err := noRedirect.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("Expected %q, got %q", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if tc.expCode == http.StatusFound {
+				if loc := r.Header.Get("Location"); loc != "/ui/" {
+					t.Errorf("Expected redirect to /ui/, got %q", loc)
+				}
+				return
+			}
+			if !strings.HasPrefix(r.Header.Get("Content-Type"), tc.expType) {
+				t.Errorf("Expected content type %q, got %q", tc.expType, r.Header.Get("Content-Type"))
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), tc.expContent) {
+				t.Errorf("Expected %q in body", tc.expContent)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	url, cleanUp := setUpAPIConfig(t, true, config{corsOrigins: []string{"http://ui.example"}})
+	defer cleanUp()
+
+	testCases := []struct {
+		name      string
+		method    string
+		origin    string
+		preflight bool
+		expCode   int
+		expOrigin string
+	}{
+		{name: "Preflight", method: http.MethodOptions, origin: "http://ui.example", preflight: true,
+			expCode: http.StatusNoContent, expOrigin: "http://ui.example"},
+		{name: "Request", method: http.MethodGet, origin: "http://ui.example",
+			expCode: http.StatusOK, expOrigin: "http://ui.example"},
+		{name: "Other origin", method: http.MethodGet, origin: "http://evil.example",
+			expCode: http.StatusOK},
+		{name: "Other origin preflight", method: http.MethodOptions, origin: "http://evil.example", preflight: true,
+			expCode: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, url+"/todo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Origin", tc.origin)
+			if tc.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+			}
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("Expected %q, got %q", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if got := r.Header.Get("Access-Control-Allow-Origin"); got != tc.expOrigin {
+				t.Errorf("Expected allowed origin %q, got %q", tc.expOrigin, got)
+			}
+			if tc.preflight && tc.expOrigin != "" &&
+				!strings.Contains(r.Header.Get("Access-Control-Allow-Headers"), "Authorization") {
+				t.Errorf("Expected Authorization to be allowed, got %q", r.Header.Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestHTMLView(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	noRedirect := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	page := func(t *testing.T, query string) string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url+"/todo"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+		r, err := noRedirect.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %q, got %q", http.StatusText(http.StatusOK), http.StatusText(r.StatusCode))
+		}
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Fatalf("Expected HTML, got %q", ct)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	post := func(t *testing.T, path, form string) string {
+		t.Helper()
+		r, err := noRedirect.Post(url+path, formMediaType, strings.NewReader(form))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusSeeOther {
+			t.Fatalf("Expected %q, got %q", http.StatusText(http.StatusSeeOther), http.StatusText(r.StatusCode))
+		}
+		return r.Header.Get("Location")
+	}
+
+	body := page(t, "")
+	for _, exp := range []string{"Test task 1", "Test task 2", `<label for="task">`, `action="/todo/2"`} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("Expected %q in page", exp)
+		}
+	}
+	_, rest, _ := strings.Cut(body, `name="csrf" value="`)
+	csrf, _, _ := strings.Cut(rest, `"`)
+	if csrf == "" {
+		t.Fatal("Expected a CSRF token in the page")
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		if loc := post(t, "/todo", "task=%3Cb%3EForm+task&csrf="+csrf); loc != "/todo" {
+			t.Fatalf("Expected redirect to /todo, got %q", loc)
+		}
+		if body := page(t, ""); !strings.Contains(body, "&lt;b&gt;Form task") {
+			t.Error("Expected the escaped task in the page")
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		if loc := post(t, "/todo", "task=+&csrf="+csrf); loc != "/todo?error=task-empty" {
+			t.Fatalf("Expected error redirect, got %q", loc)
+		}
+		if body := page(t, "?error=task-empty"); !strings.Contains(body, `role="alert"`) {
+			t.Error("Expected the error in the page")
+		}
+	})
+	t.Run("Complete", func(t *testing.T) {
+		post(t, "/todo/1", "action=complete&task=Test+task+1&csrf="+csrf)
+		if body := page(t, ""); !strings.Contains(body, `class="done">Test task 1`) {
+			t.Error("Expected item 1 completed")
+		}
+	})
+	t.Run("Stale", func(t *testing.T) {
+		if loc := post(t, "/todo/1", "action=delete&task=Other&csrf="+csrf); loc != "/todo?error=stale" {
+			t.Fatalf("Expected stale redirect, got %q", loc)
+		}
+	})
+	t.Run("BadToken", func(t *testing.T) {
+		if loc := post(t, "/todo/1", "action=delete&csrf=1."+strings.Repeat("0", 64)); loc != "/todo?error=expired" {
+			t.Fatalf("Expected expired redirect, got %q", loc)
+		}
+		if body := page(t, ""); !strings.Contains(body, "Test task 1") {
+			t.Error("Expected item 1 kept")
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		post(t, "/todo/1", "action=delete&task=Test+task+1&csrf="+csrf)
+		if body := page(t, ""); strings.Contains(body, "Test task 1") {
+			t.Error("Expected item 1 deleted")
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		r, err := http.Get(url + "/todo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected JSON without an Accept header, got %q", ct)
+		}
+	})
+}
+
+func TestItemFormMediaType(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todo.json")
+	list := todo.List{}
+	list.Add("Task 1")
+	if err := list.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	h := http.StripPrefix("/todo/", todoRouter(newStoreSet(file, "", nil, nil, nil, 0), limits{}, newHTMLView(), nil))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/todo/1", strings.NewReader(`{"action":"delete"}`))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected %q, got %q", http.StatusText(http.StatusUnsupportedMediaType), http.StatusText(w.Code))
+	}
+	if err := list.GetFile(file); err != nil || len(list) != 1 || list[0].Done {
+		t.Errorf("Expected the item untouched, got %+v and %v", list, err)
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	v := newHTMLView()
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	token := v.csrfToken("alice")
+
+	if !v.checkCSRF("alice", token) {
+		t.Error("Expected token to be valid")
+	}
+	if v.checkCSRF("bob", token) {
+		t.Error("Expected token of another user to be refused")
+	}
+	now = now.Add(csrfTTL + time.Second)
+	if v.checkCSRF("alice", token) {
+		t.Error("Expected expired token to be refused")
+	}
+}
+
+func TestPrefersHTML(t *testing.T) {
+	testCases := []struct {
+		accept string
+		exp    bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", false},
+		{"text/html", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+		{"application/json, text/html;q=0.5", false},
+		{"text/*", true},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/todo", nil)
+		r.Header.Set("Accept", tc.accept)
+		if got := prefersHTML(r); got != tc.exp {
+			t.Errorf("Accept %q: expected %t, got %t", tc.accept, tc.exp, got)
+		}
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	url, cleanup := setUpAPI(t, true)
+	defer cleanup()
+
+	testCases := []struct {
+		name    string
+		path    string
+		accept  string
+		expCode int
+		expType string
+		expBody string
+	}{
+		{name: "Default JSON", path: "/todo", accept: "*/*", expCode: http.StatusOK,
+			expType: "application/json", expBody: `{"results":[`},
+		{name: "Text", path: "/todo", accept: "text/plain", expCode: http.StatusOK,
+			expType: "text/plain; charset=utf-8", expBody: "  1: Test task 1\n  2: Test task 2\n"},
+		{name: "Text item", path: "/todo/2", accept: "text/plain", expCode: http.StatusOK,
+			expType: "text/plain; charset=utf-8", expBody: "  2: Test task 2\n"},
+		{name: "CSV", path: "/todo", accept: "text/csv", expCode: http.StatusOK,
+			expType: "text/csv; charset=utf-8", expBody: "id,task,done,created_at,completed_at\n1,Test task 1,false,"},
+		{name: "YAML alias", path: "/todo/2", accept: "application/x-yaml", expCode: http.StatusOK,
+			expType: "application/yaml", expBody: "results:\n    - id: 2\n      task: Test task 2\n      done: false\n"},
+		{name: "NDJSON", path: "/todo", accept: "application/x-ndjson", expCode: http.StatusOK,
+			expType: "application/x-ndjson", expBody: `{"id":1,"task":"Test task 1","done":false,"created_at":`},
+		{name: "Quality", path: "/todo", accept: "application/json;q=0.5, text/csv", expCode: http.StatusOK,
+			expType: "text/csv; charset=utf-8", expBody: "id,task"},
+		{name: "Format overrides Accept", path: "/todo?format=text", accept: "application/json", expCode: http.StatusOK,
+			expType: "text/plain; charset=utf-8", expBody: "  1: Test task 1\n"},
+		{name: "Not acceptable", path: "/todo", accept: "application/xml", expCode: http.StatusNotAcceptable,
+			expType: "text/plain; charset=utf-8", expBody: "Not Acceptable"},
+		{name: "Refused JSON", path: "/todo/1", accept: "application/json;q=0", expCode: http.StatusNotAcceptable,
+			expType: "text/plain; charset=utf-8", expBody: "Not Acceptable"},
+		{name: "No HTML item", path: "/todo/1?format=html", expCode: http.StatusNotAcceptable,
+			expType: "text/plain; charset=utf-8", expBody: "Not Acceptable"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, url+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			r, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("Expected %q, got %q", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if ct := r.Header.Get("Content-Type"); ct != tc.expType {
+				t.Errorf("Expected Content-Type %q, got %q", tc.expType, ct)
+			}
+			if !strings.HasPrefix(string(body), tc.expBody) {
+				t.Errorf("Expected body starting with %q, got %q", tc.expBody, body)
+			}
+			if tc.expCode == http.StatusOK && !slices.Contains(r.Header.Values("Vary"), "Accept") {
+				t.Errorf("Expected Vary: Accept, got %q", r.Header.Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	url, cleanup := setUpAPI(t, true)
+	defer cleanup()
+
+	for i := 0; i < 50; i++ {
+		r, err := http.Post(url+"/todo", "application/json",
+			strings.NewReader(fmt.Sprintf(`{"task":"Compressed task %d"}`, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	// Without DisableCompression the transport asks for gzip itself and
+	// hides the Content-Encoding.
+	c := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	get := func(t *testing.T, path, acceptEncoding string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		r, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r, body
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		expEncoding    string
+	}{
+		{name: "Gzip", path: "/todo", acceptEncoding: "gzip", expEncoding: "gzip"},
+		{name: "Zstd preferred", path: "/todo", acceptEncoding: "gzip, zstd", expEncoding: "zstd"},
+		{name: "Quality", path: "/todo", acceptEncoding: "zstd;q=0.5, gzip", expEncoding: "gzip"},
+		{name: "Any", path: "/todo", acceptEncoding: "*", expEncoding: "zstd"},
+		{name: "Identity", path: "/todo", acceptEncoding: "identity", expEncoding: ""},
+		{name: "Refused", path: "/todo", acceptEncoding: "gzip;q=0", expEncoding: ""},
+		{name: "Small body", path: "/todo/1", acceptEncoding: "gzip", expEncoding: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, body := get(t, tc.path, tc.acceptEncoding)
+			if ce := r.Header.Get("Content-Encoding"); ce != tc.expEncoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tc.expEncoding, ce)
+			}
+			if !slices.Contains(r.Header.Values("Vary"), "Accept-Encoding") {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", r.Header.Values("Vary"))
+			}
+
+			var dec io.Reader = bytes.NewReader(body)
+			switch tc.expEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(dec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dec = zr
+			case "zstd":
+				zr, err := zstd.NewReader(dec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer zr.Close()
+				dec = zr
+			}
+			var resp todoResponse
+			if err := json.NewDecoder(dec).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if tc.path == "/todo" && len(resp.Results) != 52 {
+				t.Errorf("Expected 52 items, got %d", len(resp.Results))
+			}
+		})
+	}
+
+	t.Run("Event stream", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/todo/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		r, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		if ce := r.Header.Get("Content-Encoding"); ce != "" {
+			t.Errorf("Expected uncompressed stream, got %q", ce)
+		}
+	})
+}
+
+func TestConditionalGet(t *testing.T) {
+	url, cleanup := setUpAPI(t, true)
+	defer cleanup()
+
+	get := func(t *testing.T, path string, header ...string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, r.Body)
+		r.Body.Close()
+		return r
+	}
+
+	first := get(t, "/todo")
+	etag, lastMod := first.Header.Get("ETag"), first.Header.Get("Last-Modified")
+	if !strings.HasPrefix(etag, `W/"`) || lastMod == "" {
+		t.Fatalf("Expected validators, got ETag %q and Last-Modified %q", etag, lastMod)
+	}
+	if cc := first.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Expected Cache-Control no-cache, got %q", cc)
+	}
+
+	t.Run("ETag", func(t *testing.T) {
+		if r := get(t, "/todo", "If-None-Match", etag); r.StatusCode != http.StatusNotModified {
+			t.Errorf("Expected %q, got %q", http.StatusText(http.StatusNotModified), r.Status)
+		}
+	})
+	t.Run("Other format", func(t *testing.T) {
+		r := get(t, "/todo?format=csv", "If-None-Match", etag)
+		if r.StatusCode != http.StatusOK || r.Header.Get("ETag") == etag {
+			t.Errorf("Expected a new CSV representation, got %q with ETag %q", r.Status, r.Header.Get("ETag"))
+		}
+	})
+	t.Run("Last-Modified", func(t *testing.T) {
+		if r := get(t, "/todo/1", "If-Modified-Since", lastMod); r.StatusCode != http.StatusNotModified {
+			t.Errorf("Expected %q, got %q", http.StatusText(http.StatusNotModified), r.Status)
+		}
+	})
+	t.Run("HTML", func(t *testing.T) {
+		r := get(t, "/todo", "Accept", "text/html", "If-None-Match", "*")
+		if r.StatusCode != http.StatusOK || r.Header.Get("ETag") != "" {
+			t.Errorf("Expected the HTML page uncached, got %q with ETag %q", r.Status, r.Header.Get("ETag"))
+		}
+	})
+
+	r, err := http.Post(url+"/todo", "application/json", strings.NewReader(`{"task":"Changed"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+
+	t.Run("Changed", func(t *testing.T) {
+		// Within the same second only the ETag tells the copy is stale.
+		r := get(t, "/todo", "If-None-Match", etag, "If-Modified-Since", lastMod)
+		if r.StatusCode != http.StatusOK || r.Header.Get("ETag") == etag {
+			t.Errorf("Expected the changed list, got %q with ETag %q", r.Status, r.Header.Get("ETag"))
+		}
+	})
+
+	t.Run("Same modification time", func(t *testing.T) {
+		st := &store{file: filepath.Join(t.TempDir(), "todo.json")}
+		list := todo.List{}
+		list.Add("Task 1")
+		if err := list.Save(st.file); err != nil {
+			t.Fatal(err)
+		}
+		mod, _ := st.stat()
+		w := httptest.NewRecorder()
+		notModified(w, httptest.NewRequest(http.MethodGet, "/todo", nil), st, formatJSON)
+		etag := w.Header().Get("ETag")
+
+		// A write the file system's clock does not see.
+		list.Add("Task 2")
+		if err := list.Save(st.file); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(st.file, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/todo", nil)
+		req.Header.Set("If-None-Match", etag)
+		if notModified(w, req, st, formatJSON) || w.Header().Get("ETag") == etag {
+			t.Errorf("Expected a new ETag for the longer list, got %q", w.Header().Get("ETag"))
+		}
+	})
+}
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	users := userList{
+		{Name: "alice", Token: "alice-token", Admin: true},
+		{Name: "bob", Token: "bob-token"},
+	}
+	auditFile := dir + "/audit.jsonl"
+	audit, err := openAuditLog(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(newMux(config{todoFile: dir + "/shared.json", dataDir: dir, users: users, audit: audit}))
+	defer ts.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set(requestIDHeader, "req-"+method+"-"+path)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	do(http.MethodPost, "/todo", "alice-token", `{"task":"Alice task"}`)
+	do(http.MethodPost, "/todo", "bob-token", `{"task":"Bob task"}`)
+	do(http.MethodPatch, "/todo/1?complete", "bob-token", "")
+	do(http.MethodPatch, "/todo/1", "alice-token", `{"task":"Renamed"}`)
+	do(http.MethodPost, "/todo/batch", "alice-token", `{"operations":[{"op":"add","task":"Batched"},{"op":"delete","id":1}]}`)
+
+	get := func(t *testing.T, query string) []auditEntry {
+		t.Helper()
+		r := do(http.MethodGet, "/audit"+query, "alice-token", "")
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %q, got %q", http.StatusText(http.StatusOK), r.Status)
+		}
+		var resp struct {
+			Results []auditEntry `json:"results"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Results
+	}
+
+	t.Run("Entries", func(t *testing.T) {
+		entries := get(t, "")
+		var ops []string
+		for _, e := range entries {
+			ops = append(ops, e.Actor+" "+e.Op)
+		}
+		exp := []string{"alice add", "bob add", "bob complete", "alice edit", "alice add", "alice delete"}
+		if !slices.Equal(ops, exp) {
+			t.Fatalf("Expected %q, got %q", exp, ops)
+		}
+		edit := entries[3]
+		if !strings.Contains(string(edit.Before), `"Task":"Alice task"`) || !strings.Contains(string(edit.After), `"Task":"Renamed"`) {
+			t.Errorf("Expected the task before and after the edit, got %s and %s", edit.Before, edit.After)
+		}
+		if edit.RequestID != "req-PATCH-/todo/1" || edit.RemoteAddr == "" {
+			t.Errorf("Expected request ID and remote address, got %q and %q", edit.RequestID, edit.RemoteAddr)
+		}
+		if del := entries[5]; del.Position != 1 || del.After != nil || !strings.Contains(string(del.Before), "Renamed") {
+			t.Errorf("Expected deleted item 1 before the delete only, got %+v", del)
+		}
+		if complete := entries[2]; !strings.Contains(string(complete.Before), `"Done":false`) ||
+			!strings.Contains(string(complete.After), `"Done":true`) {
+			t.Errorf("Expected the item before and after completion, got %+v", complete)
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		if entries := get(t, "?actor=bob"); len(entries) != 2 {
+			t.Errorf("Expected 2 entries by bob, got %d", len(entries))
+		}
+		future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+		if entries := get(t, "?since="+future); len(entries) != 0 {
+			t.Errorf("Expected no entries in the future, got %d", len(entries))
+		}
+	})
+
+	t.Run("Admin only", func(t *testing.T) {
+		if r := do(http.MethodGet, "/audit", "bob-token", ""); r.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected %q, got %q", http.StatusText(http.StatusForbidden), r.Status)
+		}
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		n, err := verifyAudit(auditFile)
+		if err != nil || n != 6 {
+			t.Fatalf("Expected 6 valid entries, got %d and %v", n, err)
+		}
+
+		// A reopened log continues the chain.
+		reopened, err := openAuditLog(auditFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added := todo.List{}
+		added.Add("Added offline")
+		if err := reopened.record(context.Background(), event{Type: eventAdded, Position: 3, Item: added[0], Time: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := verifyAudit(auditFile); err != nil || n != 7 {
+			t.Fatalf("Expected 7 valid entries, got %d and %v", n, err)
+		}
+
+		data, err := os.ReadFile(auditFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tampered := strings.Replace(string(data), `"actor":"bob"`, `"actor":"alice"`, 1)
+		if err := os.WriteFile(auditFile, []byte(tampered), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := verifyAudit(auditFile); !errors.Is(err, ErrAuditChain) {
+			t.Errorf("Expected %q, got %v", ErrAuditChain, err)
+		}
+		if r := do(http.MethodGet, "/audit", "alice-token", ""); r.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Expected %q for a broken chain, got %q", http.StatusText(http.StatusInternalServerError), r.Status)
+		}
+	})
+
+	t.Run("Write failure", func(t *testing.T) {
+		// A directory in place of the file makes appends fail.
+		if err := os.Remove(auditFile); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(auditFile, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		count := func() int {
+			var resp todoResponse
+			if err := json.NewDecoder(do(http.MethodGet, "/todo", "bob-token", "").Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			return len(resp.Results)
+		}
+		before := count()
+		if r := do(http.MethodPost, "/todo", "bob-token", `{"task":"Unaudited"}`); r.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Expected %q when the change is not audited, got %q", http.StatusText(http.StatusInternalServerError), r.Status)
+		}
+		if r := do(http.MethodPost, "/todo", "bob-token", `{"task":"Refused"}`); r.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Expected %q while the log is broken, got %q", http.StatusText(http.StatusInternalServerError), r.Status)
+		}
+		if got := count(); got != before+1 {
+			t.Errorf("Expected only the first change saved, got %d items after %d", got, before)
+		}
+		if !errors.Is(audit.check(), ErrAuditChain) {
+			t.Errorf("Expected the log marked broken, got %v", audit.check())
+		}
+	})
+}
+
+func TestTrash(t *testing.T) {
+	dir := t.TempDir()
+	todoFile := dir + "/todo.json"
+	list := todo.NewList()
+	for _, task := range []string{"Task 1", "Task 2", "Task 3"} {
+		list.Add(task)
+	}
+	if err := list.Save(todoFile); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(newMux(config{todoFile: todoFile, trashDays: 7, limits: limits{maxItems: 3}}))
+	defer ts.Close()
+
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	trash := func(t *testing.T) todo.Trash {
+		t.Helper()
+		var resp struct {
+			Results todo.Trash `json:"results"`
+		}
+		if err := json.NewDecoder(do(http.MethodGet, "/todo/trash", "").Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Results
+	}
+	tasks := func(t *testing.T) string {
+		t.Helper()
+		var resp todoResponse
+		if err := json.NewDecoder(do(http.MethodGet, "/todo", "").Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, it := range resp.Results {
+			names = append(names, it.Task)
+		}
+		return strings.Join(names, ", ")
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		do(http.MethodDelete, "/todo/2", "")
+		do(http.MethodPost, "/todo/batch", `{"operations":[{"op":"delete","id":1}]}`)
+		got := trash(t)
+		if len(got) != 2 || got[0].Task != "Task 2" || got[0].Position != 2 || got[1].Task != "Task 1" {
+			t.Fatalf("Expected Task 2 and Task 1 in the trash, got %+v", got)
+		}
+		if got[0].DeletedAt.IsZero() {
+			t.Error("Expected the deletion time")
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		r := do(http.MethodPost, "/todo/trash/2/restore", "")
+		if r.StatusCode != http.StatusOK || r.Header.Get("Location") != "/todo/1" {
+			t.Fatalf("Expected Task 1 restored at /todo/1, got %q at %q", r.Status, r.Header.Get("Location"))
+		}
+		do(http.MethodPost, "/todo/trash/1/restore", "")
+		if got := tasks(t); got != "Task 1, Task 2, Task 3" {
+			t.Errorf("Expected the list as it was, got %q", got)
+		}
+		if got := trash(t); len(got) != 0 {
+			t.Errorf("Expected an empty trash, got %+v", got)
+		}
+		if r := do(http.MethodPost, "/todo/trash/1/restore", ""); r.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected %q, got %q", http.StatusText(http.StatusNotFound), r.Status)
+		}
+	})
+
+	t.Run("List full", func(t *testing.T) {
+		do(http.MethodDelete, "/todo/3", "")
+		do(http.MethodPost, "/todo", `{"task":"Task 4"}`)
+		if r := do(http.MethodPost, "/todo/trash/1/restore", ""); r.StatusCode != http.StatusConflict {
+			t.Errorf("Expected %q, got %q", http.StatusText(http.StatusConflict), r.Status)
+		}
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		st := &store{file: todoFile}
+		old := todo.Trash{}
+		if err := old.GetFile(st.trashFile()); err != nil {
+			t.Fatal(err)
+		}
+		old[0].DeletedAt = time.Now().AddDate(0, 0, -8)
+		if err := old.Save(st.trashFile()); err != nil {
+			t.Fatal(err)
+		}
+		if got := trash(t); len(got) != 0 {
+			t.Errorf("Expected items older than 7 days purged, got %+v", got)
+		}
+	})
+
+	t.Run("Failed save", func(t *testing.T) {
+		st := &store{file: filepath.Join(t.TempDir(), "todo.json")}
+		list := todo.List{}
+		list.Add("Task 1")
+		st.lock()
+		defer st.Unlock()
+		if err := st.remove(&list, 1); err != nil {
+			t.Fatal(err)
+		}
+		// A directory in place of the list file makes the save fail.
+		if err := os.MkdirAll(filepath.Join(st.file, "busy"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.commit(context.Background(), &list, event{Type: eventDeleted, Position: 1}); err == nil {
+			t.Fatal("Expected the list save to fail")
+		}
+		saved := todo.Trash{}
+		if err := saved.GetFile(st.trashFile()); err != nil {
+			t.Fatal(err)
+		}
+		if len(saved) != 0 {
+			t.Errorf("Expected the trash rolled back, got %+v", saved)
+		}
+	})
+
+	t.Run("Purge on write", func(t *testing.T) {
+		st := &store{file: todoFile}
+		do(http.MethodDelete, "/todo/1", "")
+		saved := todo.Trash{}
+		if err := saved.GetFile(st.trashFile()); err != nil {
+			t.Fatal(err)
+		}
+		if len(saved) != 1 || saved[0].Task != "Task 1" {
+			t.Errorf("Expected only Task 1 left in the trash file, got %+v", saved)
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	search := func(t *testing.T, q string) []searchResult {
+		t.Helper()
+		r, err := http.Get(url + "/todo/search?q=" + q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %q, got %q", http.StatusText(http.StatusOK), r.Status)
+		}
+		var resp struct {
+			Results []searchResult `json:"results"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Results
+	}
+	send := func(t *testing.T, method, path, body string) {
+		t.Helper()
+		req, err := http.NewRequest(method, url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+	}
+
+	t.Run("Results", func(t *testing.T) {
+		got := search(t, "TEST+tas")
+		if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+			t.Fatalf("Expected items 1 and 2, got %+v", got)
+		}
+		exp := []matchRange{{0, 4}, {5, 9}}
+		if !slices.Equal(got[0].Matches, exp) {
+			t.Errorf("Expected matches %v, got %v", exp, got[0].Matches)
+		}
+		if got := search(t, "2"); len(got) != 1 || got[0].Task != "Test task 2" {
+			t.Errorf("Expected Test task 2, got %+v", got)
+		}
+	})
+
+	t.Run("Follows changes", func(t *testing.T) {
+		send(t, http.MethodPost, "/todo", `{"task":"Pay the café invoice"}`)
+		send(t, http.MethodPatch, "/todo/3?move=1", "")
+		send(t, http.MethodDelete, "/todo/2", "")
+		send(t, http.MethodPatch, "/todo/2", `{"task":"Renamed"}`)
+		if got := search(t, "cafe"); len(got) != 1 || got[0].ID != 1 {
+			t.Errorf("Expected the moved item 1, got %+v", got)
+		}
+		if got := search(t, "test"); len(got) != 0 {
+			t.Errorf("Expected no test task left, got %+v", got)
+		}
+		if got := search(t, "renamed"); len(got) != 1 || got[0].ID != 2 {
+			t.Errorf("Expected renamed item 2, got %+v", got)
+		}
+	})
+}
+
+func TestStats(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	r, err := http.Post(url+"/todo/batch", "application/json", strings.NewReader(`{"operations":[{"op":"complete","id":1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+
+	t.Run("JSON", func(t *testing.T) {
+		r, err := http.Get(url + "/todo/stats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		var stats todo.Stats
+		if err := json.NewDecoder(r.Body).Decode(&stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Total != 2 || stats.Done != 1 || stats.CompletionRate != 0.5 || stats.PerDay[len(stats.PerDay)-1].Count != 1 {
+			t.Errorf("Expected 1 of 2 items done today, got %+v", stats)
+		}
+		if len(stats.Oldest) != 1 || stats.Oldest[0].ID != 2 {
+			t.Errorf("Expected item 2 open, got %v", stats.Oldest)
+		}
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, url+"/todo/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "text/plain")
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(body), "Items:            2 (1 open, 1 done)\n") {
+			t.Errorf("Expected a text report, got %q", body)
+		}
+	})
+}
+
+func TestCharts(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	testCases := []struct {
+		name     string
+		path     string
+		expCode  int
+		expShape string
+	}{
+		{name: "Burndown", path: "/todo/charts/burndown.svg?days=7", expCode: http.StatusOK, expShape: "<polyline"},
+		{name: "Heatmap", path: "/todo/charts/heatmap.svg", expCode: http.StatusOK, expShape: "<rect"},
+		{name: "TooFewDays", path: "/todo/charts/burndown.svg?days=1", expCode: http.StatusBadRequest},
+		{name: "Unknown", path: "/todo/charts/pie.svg", expCode: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.Get(url + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("Expected %q, got %q.", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if tc.expShape == "" {
+				return
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "image/svg+xml" {
+				t.Errorf("Expected image/svg+xml, got %q", ct)
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(body), "<?xml") || !strings.Contains(string(body), tc.expShape) {
+				t.Errorf("Expected an SVG with %s, got %q", tc.expShape, body)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "report.md.tmpl"),
+		[]byte(`{{len .Completed}} done since {{.Since.Format "2006"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := loadReportTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		reports *reportTemplates
+		path    string
+		expCode int
+		expType string
+		expBody []string
+	}{
+		{name: "Markdown", path: "/todo/report", expCode: http.StatusOK, expType: "text/markdown",
+			expBody: []string{"# Todo report ", "## Completed (1)\n\n- Test task 1 (#1, done ", "## Added (2)\n\n- ~~Test task 1~~ (#1, "}},
+		{name: "HTML", path: "/todo/report?since=2w&format=html", expCode: http.StatusOK, expType: "text/html",
+			expBody: []string{"<!DOCTYPE html>", "<h2>Completed (1)</h2>", `<span class="done">Test task 1</span>`}},
+		{name: "Custom", reports: custom, path: "/todo/report?since=36h", expCode: http.StatusOK, expType: "text/markdown",
+			expBody: []string{"1 done since 20"}},
+		{name: "BadSince", path: "/todo/report?since=-3d", expCode: http.StatusBadRequest},
+		{name: "OverflowDays", path: "/todo/report?since=99999999999d", expCode: http.StatusBadRequest},
+		{name: "OverflowWeeks", path: "/todo/report?since=15251w", expCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url, cleanUp := setUpAPIConfig(t, true, config{reports: tc.reports})
+			defer cleanUp()
+			r, err := http.Post(url+"/todo/batch", "application/json", strings.NewReader(`{"operations":[{"op":"complete","id":1}]}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Body.Close()
+
+			r, err = http.Get(url + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+			if r.StatusCode != tc.expCode {
+				t.Fatalf("Expected %q, got %q.", http.StatusText(tc.expCode), http.StatusText(r.StatusCode))
+			}
+			if tc.expType == "" {
+				return
+			}
+			if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, tc.expType) {
+				t.Errorf("Expected %s, got %q", tc.expType, ct)
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, exp := range tc.expBody {
+				if !strings.Contains(string(body), exp) {
+					t.Errorf("Expected %q in report:\n%s", exp, body)
+				}
+			}
+		})
+	}
+
+	if _, err := loadReportTemplates(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing template directory")
+	}
+}
+
+func TestTimer(t *testing.T) {
+	url, cleanUp := setUpAPI(t, true)
+	defer cleanUp()
+
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	r := do(http.MethodPost, "/todo/timer", `{"id":2,"note":"first pass"}`)
+	if r.StatusCode != http.StatusCreated || r.Header.Get("Location") != "/todo/2" {
+		t.Fatalf("Expected timer started on /todo/2, got %s and %q", r.Status, r.Header.Get("Location"))
+	}
+	if r := do(http.MethodPost, "/todo/timer", `{"id":1}`); r.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a second timer to conflict, got %s", r.Status)
+	}
+
+	var timer timerResponse
+	if err := json.NewDecoder(do(http.MethodGet, "/todo/timer", "").Body).Decode(&timer); err != nil {
+		t.Fatal(err)
+	}
+	if timer.ID != 2 || timer.Note != "first pass" || timer.Stop != nil {
+		t.Errorf("Expected a running timer on item 2, got %+v", timer)
+	}
+
+	var resp todoResponse
+	if err := json.NewDecoder(do(http.MethodGet, "/todo/2", "").Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if entries := resp.Results[0].TimeEntries; len(entries) != 1 || !entries[0].Running() {
+		t.Errorf("Expected item 2 to show its running entry, got %+v", entries)
+	}
+
+	if r := do(http.MethodPatch, "/todo/2?complete", ""); r.StatusCode != http.StatusOK {
+		t.Fatalf("Expected item 2 completed, got %s", r.Status)
+	}
+	if r := do(http.MethodDelete, "/todo/timer", ""); r.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected completing item 2 to stop its timer, got %s", r.Status)
+	}
+
+	do(http.MethodPost, "/todo/timer", `{"id":1}`)
+	r = do(http.MethodDelete, "/todo/timer", "")
+	if err := json.NewDecoder(r.Body).Decode(&timer); err != nil {
+		t.Fatal(err)
+	}
+	if timer.ID != 1 || timer.Stop == nil {
+		t.Errorf("Expected the timer of item 1 stopped, got %+v", timer)
+	}
+
+	body, err := io.ReadAll(do(http.MethodGet, "/todo/timesheet?period=week&format=text", "").Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"1: Test task 1", "2: Test task 2", "Total"} {
+		if !strings.Contains(string(body), exp) {
+			t.Errorf("Expected %q in timesheet:\n%s", exp, body)
+		}
+	}
+
+	t.Run("Delete and restore", func(t *testing.T) {
+		do(http.MethodPost, "/todo/timer", `{"id":1,"note":"second pass"}`)
+		if r := do(http.MethodDelete, "/todo/1", ""); r.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected item 1 deleted, got %s", r.Status)
+		}
+		if r := do(http.MethodGet, "/todo/timer", ""); r.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected deleting item 1 to stop its timer, got %s", r.Status)
+		}
+
+		var trash struct {
+			Results todo.Trash `json:"results"`
+		}
+		if err := json.NewDecoder(do(http.MethodGet, "/todo/trash", "").Body).Decode(&trash); err != nil {
+			t.Fatal(err)
+		}
+		if len(trash.Results) != 1 {
+			t.Fatalf("Expected item 1 in the trash, got %+v", trash.Results)
+		}
+		entries := trash.Results[0].TimeEntries
+		if len(entries) != 2 || entries[1].Note != "second pass" || entries[1].Running() {
+			t.Errorf("Expected both entries kept with the timer stopped, got %+v", entries)
+		}
+
+		r := do(http.MethodPost, "/todo/trash/1/restore", "")
+		if r.StatusCode != http.StatusOK {
+			t.Fatalf("Expected item 1 restored, got %s", r.Status)
+		}
+		var resp todoResponse
+		if err := json.NewDecoder(do(http.MethodGet, r.Header.Get("Location"), "").Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Results[0].TimeEntries; len(got) != 2 || got[0].Note != "" || got[1].Note != "second pass" {
+			t.Errorf("Expected the restored item to keep its entries, got %+v", got)
+		}
+	})
+}
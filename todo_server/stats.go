@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// statsFormats are the formats of GET /todo/stats.
+var statsFormats = []string{formatJSON, formatText}
+
+// statsHandler serves GET /todo/stats, the throughput of the list as a
+// JSON document or a text report. Days and weeks are the server's.
+func statsHandler(w http.ResponseWriter, r *http.Request, list *todo.List) {
+	if r.Method != http.MethodGet {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	format, ok := negotiate(w, r, statsFormats)
+	if !ok {
+		replyNotAcceptable(w, r, statsFormats)
+		return
+	}
+	stats := list.Stats(time.Now())
+	if format == formatText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(stats.String()))
+		return
+	}
+	replyJSON(w, r, http.StatusOK, stats)
+}
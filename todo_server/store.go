@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// store is a single todo list file guarded by its own lock.
+type store struct {
+	sync.Mutex
+	file   string
+	user   string
+	m      *metrics
+	events *eventLog
+	hooks  *webhooks
+	audit  *auditLog
+
+	// trashDays is how long deleted items are kept, 0 keeps them
+	// until restored.
+	trashDays int
+
+	// trash is the trash items are deleted into and restored from while
+	// the lock is held, nil until first used. commit saves it, and puts
+	// back savedTrash, the trash as loaded, when the list save fails.
+	trash      *todo.Trash
+	savedTrash todo.Trash
+
+	// index is the search index of the list as it was saved at
+	// indexTime, nil until the first search.
+	index     *todo.Index
+	indexTime time.Time
+}
+
+// lock acquires the store lock and records how long it took.
+func (st *store) lock() {
+	start := time.Now()
+	st.Lock()
+	st.m.observeLockWait(time.Since(start))
+	st.trash, st.savedTrash = nil, nil
+}
+
+func (st *store) load(list *todo.List) error {
+	start := time.Now()
+	err := list.GetFile(st.file)
+	st.m.observeStorage("load", time.Since(start), err)
+	if err == nil {
+		st.count(list)
+	}
+	return err
+}
+
+func (st *store) save(list *todo.List) error {
+	start := time.Now()
+	err := list.Save(st.file)
+	st.m.observeStorage("save", time.Since(start), err)
+	if err == nil {
+		st.count(list)
+	}
+	return err
+}
+
+// trashFile keeps the items deleted from the list, next to its file.
+func (st *store) trashFile() string {
+	return strings.TrimSuffix(st.file, ".json") + ".trash.json"
+}
+
+// loadTrash reads the trash and drops the items kept longer than
+// trashDays.
+func (st *store) loadTrash(trash *todo.Trash) error {
+	start := time.Now()
+	err := trash.GetFile(st.trashFile())
+	st.m.observeStorage("load", time.Since(start), err)
+	if err == nil && st.trashDays > 0 {
+		trash.Purge(time.Now().AddDate(0, 0, -st.trashDays))
+	}
+	return err
+}
+
+// saveTrash drops the items kept longer than trashDays and writes the
+// trash.
+func (st *store) saveTrash(trash *todo.Trash) error {
+	if st.trashDays > 0 {
+		trash.Purge(time.Now().AddDate(0, 0, -st.trashDays))
+	}
+	start := time.Now()
+	err := trash.Save(st.trashFile())
+	st.m.observeStorage("save", time.Since(start), err)
+	return err
+}
+
+// openTrash returns the trash of the list for changes commit saves. The
+// store lock must be held.
+func (st *store) openTrash() (*todo.Trash, error) {
+	if st.trash == nil {
+		trash := todo.NewTrash()
+		if err := st.loadTrash(trash); err != nil {
+			return nil, err
+		}
+		st.trash, st.savedTrash = trash, slices.Clone(*trash)
+	}
+	return st.trash, nil
+}
+
+// remove deletes item i of list into the trash, which commit saves. The
+// store lock must be held.
+func (st *store) remove(list *todo.List, i int) error {
+	trash, err := st.openTrash()
+	if err != nil {
+		return err
+	}
+	return trash.Delete(list, i)
+}
+
+// commit saves list after the changes in events and publishes them as
+// made in ctx. A changed trash is saved first and put back when the list
+// cannot be saved, so an item is never in both or in neither. Changes
+// are refused while the audit log is broken, and a change saved but not
+// audited returns the audit error.
+func (st *store) commit(ctx context.Context, list *todo.List, events ...event) error {
+	if err := st.audit.check(); err != nil {
+		return err
+	}
+	trash, saved := st.trash, st.savedTrash
+	st.trash, st.savedTrash = nil, nil
+	if trash != nil {
+		if err := st.saveTrash(trash); err != nil {
+			return err
+		}
+	}
+	prev := st.modTime()
+	if err := st.save(list); err != nil {
+		if trash != nil {
+			if rollbackErr := st.saveTrash(&saved); rollbackErr != nil {
+				return errors.Join(err, fmt.Errorf("trash not rolled back: %w", rollbackErr))
+			}
+		}
+		return err
+	}
+	st.reindex(prev, events)
+	var auditErr error
+	for _, e := range events {
+		if err := st.publish(ctx, e); err != nil && auditErr == nil {
+			auditErr = err
+		}
+	}
+	return auditErr
+}
+
+// modTime returns when the list file was last written, zero when there
+// is none yet.
+func (st *store) modTime() time.Time {
+	mod, _ := st.stat()
+	return mod
+}
+
+// stat returns when the list file was last written and its size, zero
+// when there is none yet.
+func (st *store) stat() (time.Time, int64) {
+	fi, err := os.Stat(st.file)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return fi.ModTime(), fi.Size()
+}
+
+// update runs fn on the list under the store lock. When fn returns
+// events they are committed as made in ctx.
+func (st *store) update(ctx context.Context, fn func(list *todo.List) ([]event, error)) error {
+	st.lock()
+	defer st.Unlock()
+
+	list := &todo.List{}
+	if err := st.load(list); err != nil {
+		return err
+	}
+	events, err := fn(list)
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	return st.commit(ctx, list, events...)
+}
+
+// publish announces a change to the list on its stream and webhooks and
+// records it in the audit log with the caller in ctx. The list is saved
+// already, so an audit failure is only logged.
+func (st *store) publish(ctx context.Context, e event) error {
+	e = st.events.publish(e)
+	st.hooks.notify(st.user, e)
+	if err := st.audit.record(ctx, e); err != nil {
+		logger, ok := ctx.Value(loggerKey{}).(*slog.Logger)
+		if !ok {
+			logger = slog.Default()
+		}
+		logger.Error("Fail to write audit log", "error", err, "event", e.Type, "position", e.Position)
+		return err
+	}
+	return nil
+}
+
+func (st *store) count(list *todo.List) {
+	c := listCount{}
+	for _, i := range *list {
+		c.items++
+		if i.Done {
+			c.completed++
+		}
+	}
+	st.m.setList(st.file, c)
+}
+
+// storeSet maps identities to their stores. Requests without an
+// identity use the shared store, which keeps single-user mode working.
+type storeSet struct {
+	shared *store
+	dir    string
+	m      *metrics
+	hooks  *webhooks
+	audit  *auditLog
+
+	trashDays int
+
+	mu     sync.Mutex
+	byUser map[string]*store
+}
+
+func newStoreSet(sharedFile, dir string, m *metrics, hooks *webhooks, audit *auditLog, trashDays int) *storeSet {
+	return &storeSet{
+		shared: &store{
+			file:      sharedFile,
+			m:         m,
+			events:    newEventLog(eventBufferSize),
+			hooks:     hooks,
+			audit:     audit,
+			trashDays: trashDays,
+		},
+		dir:       dir,
+		m:         m,
+		hooks:     hooks,
+		audit:     audit,
+		trashDays: trashDays,
+		byUser:    map[string]*store{},
+	}
+}
+
+func (s *storeSet) forUser(name string) *store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.byUser[name]
+	if !ok {
+		st = &store{
+			file:      userFile(s.dir, name),
+			user:      name,
+			m:         s.m,
+			events:    newEventLog(eventBufferSize),
+			hooks:     s.hooks,
+			audit:     s.audit,
+			trashDays: s.trashDays,
+		}
+		s.byUser[name] = st
+	}
+	return st
+}
+
+func (s *storeSet) forRequest(r *http.Request) *store {
+	return s.forContext(r.Context())
+}
+
+// forContext returns the store of the user authenticated in ctx.
+func (s *storeSet) forContext(ctx context.Context) *store {
+	u, ok := userFromContext(ctx)
+	if !ok {
+		return s.shared
+	}
+	return s.forUser(u.Name)
+}
+
+// all returns the shared store and every user store in use.
+func (s *storeSet) all() []*store {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stores := []*store{s.shared}
+	for _, st := range s.byUser {
+		stores = append(stores, st)
+	}
+	return stores
+}
+
+// flush waits for writes that still hold a store lock. Saves are
+// synchronous, so once every lock has been taken nothing is pending.
+func (s *storeSet) flush() {
+	for _, st := range s.all() {
+		st.Lock()
+		st.Unlock()
+	}
+}
+
+// closeEvents ends all change streams so shutdown does not wait on them.
+func (s *storeSet) closeEvents() {
+	for _, st := range s.all() {
+		st.events.close()
+	}
+}
+
+func userFile(dir, name string) string {
+	return filepath.Join(dir, name+".json")
+}
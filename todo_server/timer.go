@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// timesheetFormats are the formats of GET /todo/timesheet.
+var timesheetFormats = []string{formatJSON, formatText}
+
+// timerResponse is the running timer of a list, or the one just stopped.
+type timerResponse struct {
+	ID       int           `json:"id"`
+	Task     string        `json:"task"`
+	Start    time.Time     `json:"start"`
+	Stop     *time.Time    `json:"stop,omitempty"`
+	Duration todo.Duration `json:"duration_seconds"`
+	Note     string        `json:"note"`
+}
+
+// newTimerResponse returns the last time entry of item id.
+func newTimerResponse(list *todo.List, id int, now time.Time) timerResponse {
+	it := (*list)[id-1]
+	e := it.TimeEntries[len(it.TimeEntries)-1]
+	resp := timerResponse{ID: id, Task: it.Task, Start: e.Start, Duration: e.Spent(now), Note: e.Note}
+	if !e.Running() {
+		resp.Stop = &e.Stop
+	}
+	return resp
+}
+
+// timerHandler serves /todo/timer: GET shows the running timer, POST
+// starts one on an item and DELETE stops it. A list runs one timer at a
+// time, and per-user lists make that one per user.
+func timerHandler(w http.ResponseWriter, r *http.Request, list *todo.List, st *store, lim limits) {
+	switch r.Method {
+	case http.MethodGet:
+		id := list.Running()
+		if id == 0 {
+			replyErrorContent(w, r, http.StatusNotFound, todo.ErrNoTimer.Error())
+			return
+		}
+		replyJSON(w, r, http.StatusOK, newTimerResponse(list, id, time.Now()))
+	case http.MethodPost:
+		startTimerHandler(w, r, list, st, lim)
+	case http.MethodDelete:
+		id := list.Running()
+		if id == 0 {
+			replyErrorContent(w, r, http.StatusNotFound, todo.ErrNoTimer.Error())
+			return
+		}
+		before := (*list)[id-1]
+		if _, err := list.Stop(); err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		e := event{Type: eventTimerStopped, Position: id, Item: (*list)[id-1], Before: before}
+		if err := st.commit(r.Context(), list, e); err != nil {
+			replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		replyJSON(w, r, http.StatusOK, newTimerResponse(list, id, time.Now()))
+	default:
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+	}
+}
+
+func startTimerHandler(w http.ResponseWriter, r *http.Request, list *todo.List, st *store, lim limits) {
+	req := struct {
+		ID   int    `json:"id"`
+		Note string `json:"note"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			replyErrorContent(w, r, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %s", err))
+		return
+	}
+	if req.ID < 1 || req.ID > len(*list) {
+		replyErrorContent(w, r, http.StatusNotFound, fmt.Sprintf("%s: item %d", ErrNotFound, req.ID))
+		return
+	}
+	if lim.maxTaskLen > 0 && utf8.RuneCountInString(req.Note) > lim.maxTaskLen {
+		message := fmt.Sprintf("%s: note longer than %d characters", ErrInvalidData, lim.maxTaskLen)
+		replyErrorContent(w, r, http.StatusBadRequest, message)
+		return
+	}
+	before := (*list)[req.ID-1]
+	if err := list.Start(req.ID, req.Note); err != nil {
+		if errors.Is(err, todo.ErrTimerRunning) {
+			replyErrorContent(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	e := event{Type: eventTimerStarted, Position: req.ID, Item: (*list)[req.ID-1], Before: before}
+	if err := st.commit(r.Context(), list, e); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/todo/%d", req.ID))
+	replyJSON(w, r, http.StatusCreated, newTimerResponse(list, req.ID, time.Now()))
+}
+
+// timesheetHandler serves GET /todo/timesheet, the time logged today or,
+// with ?period=week, on each day of the week from Monday. Days are the
+// server's.
+func timesheetHandler(w http.ResponseWriter, r *http.Request, list *todo.List) {
+	if r.Method != http.MethodGet {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	format, ok := negotiate(w, r, timesheetFormats)
+	if !ok {
+		replyNotAcceptable(w, r, timesheetFormats)
+		return
+	}
+	now := time.Now()
+	start, days := now, 1
+	switch period := r.URL.Query().Get("period"); period {
+	case "", "day":
+	case "week":
+		start, days = now.AddDate(0, 0, -(int(now.Weekday())+6)%7), 7
+	default:
+		replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("%s: period %q", ErrInvalidData, period))
+		return
+	}
+	ts := list.Timesheet(start, days, now)
+	if format == formatText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(ts.String()))
+		return
+	}
+	replyJSON(w, r, http.StatusOK, ts)
+}
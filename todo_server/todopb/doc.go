@@ -0,0 +1,8 @@
+// Package todopb is the gRPC API of todo_server: the messages, the
+// TodoServer interface it implements and the TodoClient to call it.
+//
+// The Go files are generated from todo.proto with protoc-gen-go and
+// protoc-gen-go-grpc, regenerate them after changing it.
+package todopb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative todo.proto
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+// trashRouter serves GET /todo/trash and POST /todo/trash/{id}/restore.
+// Trashed items are numbered from 1, oldest first.
+func trashRouter(w http.ResponseWriter, r *http.Request, list *todo.List, st *store, lim limits) {
+	trash, err := st.openTrash()
+	if err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if r.URL.Path == "trash" {
+		if r.Method != http.MethodGet {
+			replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+			return
+		}
+		replyResults(w, r, *trash, len(*trash))
+		return
+	}
+	path, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "trash/"), "/restore")
+	if !ok {
+		replyErrorContent(w, r, http.StatusNotFound, "Not Found")
+		return
+	}
+	id, err := strconv.Atoi(path)
+	switch {
+	case err != nil || id < 1:
+		replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("%s Invalid Id: %s", ErrInvalidData, path))
+		return
+	case id > len(*trash):
+		replyErrorContent(w, r, http.StatusNotFound, fmt.Sprintf("%s Trashed item: %d", ErrNotFound, id))
+		return
+	}
+	if r.Method != http.MethodPost {
+		replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	restoreHandler(w, r, list, trash, id, st, lim)
+}
+
+// restoreHandler puts trashed item id back into the list. commit saves
+// the list and the trash.
+func restoreHandler(w http.ResponseWriter, r *http.Request, list *todo.List, trash *todo.Trash, id int, st *store, lim limits) {
+	if lim.maxItems > 0 && len(*list) >= lim.maxItems {
+		message := fmt.Sprintf("%s: %d items allowed", ErrListFull, lim.maxItems)
+		replyErrorContent(w, r, http.StatusConflict, message)
+		return
+	}
+	pos, err := trash.Restore(id, list)
+	if err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	e := event{Type: eventRestored, Position: pos, Item: (*list)[pos-1]}
+	if err := st.commit(r.Context(), list, e); err != nil {
+		replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/todo/"+strconv.Itoa(pos))
+	replyTextContent(w, r, http.StatusOK, "Item restored")
+}
+
+// isTrashPath reports whether path, relative to /todo/, is in the trash.
+func isTrashPath(path string) bool {
+	return path == "trash" || strings.HasPrefix(path, "trash/")
+}
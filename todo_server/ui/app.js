@@ -0,0 +1,124 @@
+// Todo web UI. Talks to the JSON API of todo_server, on the same origin
+// unless an API URL is set, in which case the server needs CORS enabled.
+"use strict";
+
+const settings = {
+  get apiUrl() { return localStorage.getItem("apiUrl") || ""; },
+  set apiUrl(v) { localStorage.setItem("apiUrl", v.replace(/\/+$/, "")); },
+  get token() { return localStorage.getItem("token") || ""; },
+  set token(v) { localStorage.setItem("token", v); },
+};
+
+const $ = (id) => document.getElementById(id);
+
+function showStatus(message) {
+  $("status").textContent = message;
+}
+
+async function api(method, path, body, extraHeaders) {
+  const headers = Object.assign({}, extraHeaders);
+  if (settings.token) {
+    headers["Authorization"] = "Bearer " + settings.token;
+  }
+  const init = { method, headers };
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+    init.body = JSON.stringify(body);
+  }
+  const resp = await fetch(settings.apiUrl + path, init);
+  if (!resp.ok) {
+    const text = (await resp.text()).trim();
+    throw new Error(resp.status + " " + (text || resp.statusText));
+  }
+  return resp;
+}
+
+async function load() {
+  const resp = await api("GET", "/todo");
+  const data = await resp.json();
+  render(data.results || []);
+}
+
+function render(items) {
+  const list = $("items");
+  const tmpl = $("item");
+  list.replaceChildren();
+  items.forEach((item, i) => {
+    const id = i + 1;
+    const li = tmpl.content.firstElementChild.cloneNode(true);
+    li.classList.toggle("done", item.Done);
+    li.querySelector(".task").textContent = item.Task;
+    const done = li.querySelector(".done");
+    done.checked = item.Done;
+    done.disabled = item.Done;
+    done.addEventListener("change", () => run(() => api("PATCH", "/todo/" + id + "?complete")));
+    li.querySelector(".edit").addEventListener("click", () => {
+      const task = prompt("Task", item.Task);
+      if (task && task !== item.Task) {
+        run(() => api("PATCH", "/todo/" + id, { task }));
+      }
+    });
+    li.querySelector(".delete").addEventListener("click", () => {
+      if (confirm("Delete \"" + item.Task + "\"?")) {
+        run(() => api("DELETE", "/todo/" + id));
+      }
+    });
+    list.append(li);
+  });
+  if (items.length === 0) {
+    showStatus("Nothing to do.");
+  }
+}
+
+// newKey returns an Idempotency-Key, so a resubmitted form adds the
+// task once.
+function newKey() {
+  if (crypto.randomUUID) {
+    return crypto.randomUUID();
+  }
+  return Date.now().toString(36) + Math.random().toString(36).slice(2);
+}
+
+// run performs a change and reloads the list, reporting errors.
+async function run(change) {
+  showStatus("");
+  try {
+    await change();
+    await load();
+  } catch (err) {
+    showStatus(err.message);
+    load().catch(() => {});
+  }
+}
+
+$("add").addEventListener("submit", (ev) => {
+  ev.preventDefault();
+  const input = $("task");
+  const task = input.value.trim();
+  if (!task) {
+    return;
+  }
+  const key = newKey();
+  run(async () => {
+    await api("POST", "/todo", { task }, { "Idempotency-Key": key });
+    input.value = "";
+  });
+});
+
+$("settings-toggle").addEventListener("click", () => {
+  const form = $("settings");
+  form.hidden = !form.hidden;
+  $("settings-toggle").setAttribute("aria-expanded", String(!form.hidden));
+});
+
+$("settings").addEventListener("submit", (ev) => {
+  ev.preventDefault();
+  settings.apiUrl = $("api-url").value.trim();
+  settings.token = $("token").value;
+  $("settings").hidden = true;
+  run(() => Promise.resolve());
+});
+
+$("api-url").value = settings.apiUrl;
+$("token").value = settings.token;
+run(() => Promise.resolve());
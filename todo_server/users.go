@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"pragprog.com/rggo/interacting/todo"
+)
+
+var (
+	ErrUnauthorized = errors.New("Unauthorized")
+	ErrForbidden    = errors.New("Forbidden")
+)
+
+var validUserName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type user struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Admin bool   `json:"admin"`
+}
+
+// userList is the content of the users file, looked up by token.
+type userList []user
+
+type userKey struct{}
+
+func loadUsers(filename string) (userList, error) {
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var users userList
+	if err := json.Unmarshal(file, &users); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidData, err)
+	}
+	seen := map[string]bool{}
+	for _, u := range users {
+		if !validUserName.MatchString(u.Name) {
+			return nil, fmt.Errorf("%w: bad user name %q", ErrInvalidData, u.Name)
+		}
+		if u.Token == "" {
+			return nil, fmt.Errorf("%w: user %q has no token", ErrInvalidData, u.Name)
+		}
+		if seen[u.Name] || seen["token:"+u.Token] {
+			return nil, fmt.Errorf("%w: duplicate user or token for %q", ErrInvalidData, u.Name)
+		}
+		seen[u.Name] = true
+		seen["token:"+u.Token] = true
+	}
+	return users, nil
+}
+
+// byToken finds the user of token. Tokens are compared in constant time
+// and every user is checked, so response times do not tell how much of
+// a guessed token was right.
+func (ul userList) byToken(token string) (user, bool) {
+	found, ok := user{}, false
+	for _, u := range ul {
+		if subtle.ConstantTimeCompare([]byte(u.Token), []byte(token)) == 1 {
+			found, ok = u, true
+		}
+	}
+	return found, ok
+}
+
+func (ul userList) byName(name string) (user, bool) {
+	for _, u := range ul {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return user{}, false
+}
+
+func userFromContext(ctx context.Context) (user, bool) {
+	u, ok := ctx.Value(userKey{}).(user)
+	return u, ok
+}
+
+// requestToken returns the bearer token of r. Browsers without
+// JavaScript can send it as the password of HTTP Basic auth instead.
+func requestToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+// authenticate resolves the request token to a user and stores it in the
+// request context. Requests without a valid token are rejected, with a
+// Basic challenge for browsers asking for HTML so they prompt for it.
+func authenticate(users userList, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := users.byToken(requestToken(r))
+		if !ok {
+			scheme := "Bearer"
+			if prefersHTML(r) {
+				scheme = "Basic"
+			}
+			w.Header().Set("WWW-Authenticate", scheme+` realm="todo"`)
+			replyErrorContent(w, r, http.StatusUnauthorized, ErrUnauthorized.Error())
+			return
+		}
+		ctx := context.WithValue(r.Context(), userKey{}, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := userFromContext(r.Context())
+		if !ok || !u.Admin {
+			replyErrorContent(w, r, http.StatusForbidden, ErrForbidden.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type userUsage struct {
+	Name      string `json:"name"`
+	Admin     bool   `json:"admin"`
+	Items     int    `json:"items"`
+	Completed int    `json:"completed"`
+	Bytes     int64  `json:"bytes"`
+}
+
+func adminUsersHandler(users userList, stores *storeSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+			return
+		}
+		results := make([]userUsage, 0, len(users))
+		for _, u := range users {
+			usage, err := storeUsage(stores.forUser(u.Name))
+			if err != nil {
+				replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+			usage.Name = u.Name
+			usage.Admin = u.Admin
+			results = append(results, usage)
+		}
+		replyResults(w, r, results, len(results))
+	}
+}
+
+func storeUsage(st *store) (userUsage, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	usage := userUsage{}
+	list := &todo.List{}
+	if err := st.load(list); err != nil {
+		return usage, err
+	}
+	for _, i := range *list {
+		usage.Items++
+		if i.Done {
+			usage.Completed++
+		}
+	}
+	if fi, err := os.Stat(st.file); err == nil {
+		usage.Bytes = fi.Size()
+	}
+	return usage, nil
+}
+
+// migrateShared copies the shared todo file into the store of the given
+// user. It refuses to overwrite a list the user already has.
+func migrateShared(sharedFile string, stores *storeSet, users userList, name string) error {
+	if _, ok := users.byName(name); !ok {
+		return fmt.Errorf("%w: unknown user %q", ErrInvalidData, name)
+	}
+	dst := stores.forUser(name).file
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%w: %s already exists", ErrInvalidData, dst)
+	}
+	src, err := os.Open(sharedFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
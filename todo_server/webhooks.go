@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256
+// of the body keyed with the webhook secret, prefixed with "sha256=".
+const (
+	webhookSignatureHeader = "X-Todo-Signature"
+	webhookEventHeader     = "X-Todo-Event"
+	webhookDeliveryHeader  = "X-Todo-Delivery"
+)
+
+// Delivery states.
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+const (
+	webhookMaxBackoff = time.Hour
+	// webhookLogSize is how many finished deliveries are kept for the
+	// delivery log. Pending ones are always kept.
+	webhookLogSize = 500
+)
+
+var ErrConflict = errors.New("Conflict")
+
+// webhookEvents are the event types a webhook may subscribe to.
+var webhookEvents = []string{eventAdded, eventCompleted, eventDeleted, eventEdited, eventReordered, eventRestored,
+	eventTimerStarted, eventTimerStopped}
+
+// webhook is a registered endpoint. Webhooks from the config file have
+// source "config" and can only be changed there. An empty Events list
+// subscribes to every event.
+type webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h webhook) wants(eventType string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, eventType)
+}
+
+// webhookView is a webhook as the admin API shows it, without its secret.
+type webhookView struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h webhook) view() webhookView {
+	events := h.Events
+	if events == nil {
+		events = []string{}
+	}
+	return webhookView{ID: h.ID, URL: h.URL, Events: events, Source: h.Source, CreatedAt: h.CreatedAt}
+}
+
+// delivery is one event sent, or to be sent, to one webhook.
+type delivery struct {
+	ID           string          `json:"id"`
+	Webhook      string          `json:"webhook"`
+	Event        string          `json:"event"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	NextAttempt  time.Time       `json:"next_attempt,omitzero"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// webhookOptions configures delivery. An empty file keeps the queue in
+// memory only.
+type webhookOptions struct {
+	file        string
+	maxAttempts int
+	backoff     time.Duration
+	timeout     time.Duration
+	endpoints   []webhook
+}
+
+// webhookState is what the queue file holds: the webhooks registered
+// through the admin API and the delivery queue and log.
+type webhookState struct {
+	Webhooks   []webhook  `json:"webhooks"`
+	Deliveries []delivery `json:"deliveries"`
+}
+
+// webhooks queues change events for the registered endpoints and sends
+// them from a single worker, retrying failures with exponential backoff.
+// The worker also writes the queue file, so events are queued without
+// disk writes while the store lock is held. A nil *webhooks ignores
+// events.
+type webhooks struct {
+	opts   webhookOptions
+	client *http.Client
+	logger *slog.Logger
+
+	// saveMu orders writes of the queue file. It is taken before mu.
+	saveMu sync.Mutex
+
+	mu     sync.Mutex
+	config []webhook
+	state  webhookState
+	// dirty is set when state changed since the queue file was written.
+	dirty bool
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	// ctx is cancelled by stop, aborting a delivery in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newWebhooks(opts webhookOptions, logger *slog.Logger) (*webhooks, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.maxAttempts < 1 {
+		opts.maxAttempts = 1
+	}
+	wh := &webhooks{
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.timeout},
+		logger:  logger,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	wh.ctx, wh.cancel = context.WithCancel(context.Background())
+	for i, h := range opts.endpoints {
+		if err := validateWebhook(h); err != nil {
+			return nil, fmt.Errorf("webhook %d: %w", i+1, err)
+		}
+		h.ID = fmt.Sprintf("config-%d", i+1)
+		h.Source = "config"
+		wh.config = append(wh.config, h)
+	}
+	if opts.file != "" {
+		data, err := os.ReadFile(opts.file)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		case len(data) > 0:
+			if err := json.Unmarshal(data, &wh.state); err != nil {
+				return nil, fmt.Errorf("%w: %s: %s", ErrInvalidData, opts.file, err)
+			}
+		}
+	}
+	return wh, nil
+}
+
+func validateWebhook(h webhook) error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: webhook url must be an http or https URL", ErrInvalidData)
+	}
+	if h.Secret == "" {
+		return fmt.Errorf("%w: webhook secret is required", ErrInvalidData)
+	}
+	for _, e := range h.Events {
+		if !slices.Contains(webhookEvents, e) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidData, e)
+		}
+	}
+	return nil
+}
+
+// start runs the delivery worker until stop is called.
+func (wh *webhooks) start() {
+	if wh == nil {
+		return
+	}
+	go wh.run()
+}
+
+// stop ends the worker, aborting the delivery in flight. Pending
+// deliveries stay in the queue file and are sent after the next start.
+func (wh *webhooks) stop() {
+	if wh == nil {
+		return
+	}
+	wh.cancel()
+	close(wh.done)
+	<-wh.stopped
+}
+
+func (wh *webhooks) list() []webhook {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	return slices.Concat(wh.config, wh.state.Webhooks)
+}
+
+func (wh *webhooks) add(h webhook) (webhook, error) {
+	if err := validateWebhook(h); err != nil {
+		return webhook{}, err
+	}
+	h.ID = newRequestID()[:16]
+	h.Source = "api"
+	h.CreatedAt = time.Now()
+	wh.saveMu.Lock()
+	defer wh.saveMu.Unlock()
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.state.Webhooks = append(wh.state.Webhooks, h)
+	if err := wh.save(); err != nil {
+		wh.state.Webhooks = wh.state.Webhooks[:len(wh.state.Webhooks)-1]
+		return webhook{}, err
+	}
+	return h, nil
+}
+
+func (wh *webhooks) remove(id string) error {
+	wh.saveMu.Lock()
+	defer wh.saveMu.Unlock()
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	if slices.ContainsFunc(wh.config, func(h webhook) bool { return h.ID == id }) {
+		return fmt.Errorf("%w: webhook %s is defined in the config file", ErrConflict, id)
+	}
+	i := slices.IndexFunc(wh.state.Webhooks, func(h webhook) bool { return h.ID == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	wh.state.Webhooks = slices.Delete(wh.state.Webhooks, i, i+1)
+	return wh.save()
+}
+
+// deliveries returns the delivery log, newest first, optionally limited
+// to one webhook and one status.
+func (wh *webhooks) deliveries(webhookID, status string) []delivery {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	results := []delivery{}
+	for _, d := range slices.Backward(wh.state.Deliveries) {
+		if (webhookID == "" || d.Webhook == webhookID) && (status == "" || d.Status == status) {
+			results = append(results, d)
+		}
+	}
+	return results
+}
+
+// notify queues e for every webhook subscribed to its type and wakes the
+// worker, which writes the queue file. user is the owner of the list,
+// empty in single-user mode.
+func (wh *webhooks) notify(user string, e event) {
+	if wh == nil {
+		return
+	}
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	now := time.Now()
+	queued := false
+	for _, h := range slices.Concat(wh.config, wh.state.Webhooks) {
+		if !h.wants(e.Type) {
+			continue
+		}
+		d := delivery{
+			ID:          newRequestID(),
+			Webhook:     h.ID,
+			Event:       e.Type,
+			Status:      deliveryPending,
+			NextAttempt: now,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		payload, err := json.Marshal(struct {
+			Delivery string `json:"delivery"`
+			Event    string `json:"event"`
+			User     string `json:"user,omitempty"`
+			Data     event  `json:"data"`
+		}{d.ID, e.Type, user, e})
+		if err != nil {
+			wh.logger.Error("Fail to encode webhook payload", "error", err)
+			continue
+		}
+		d.Payload = payload
+		wh.state.Deliveries = append(wh.state.Deliveries, d)
+		queued = true
+	}
+	if !queued {
+		return
+	}
+	wh.dirty = true
+	select {
+	case wh.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (wh *webhooks) run() {
+	defer close(wh.stopped)
+	for {
+		wh.persist()
+		d, h, wait := wh.next()
+		if wait == 0 {
+			select {
+			case <-wh.done:
+				wh.persist()
+				return
+			default:
+			}
+			wh.deliver(d, h)
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-wh.done:
+			timer.Stop()
+			wh.persist()
+			return
+		case <-wh.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// next returns the first pending delivery that is due, or how long to
+// wait for one. Deliveries to removed webhooks fail right away.
+func (wh *webhooks) next() (delivery, webhook, time.Duration) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	now := time.Now()
+	wait := webhookMaxBackoff
+	hooks := slices.Concat(wh.config, wh.state.Webhooks)
+	for i := range wh.state.Deliveries {
+		d := &wh.state.Deliveries[i]
+		if d.Status != deliveryPending {
+			continue
+		}
+		h := slices.IndexFunc(hooks, func(h webhook) bool { return h.ID == d.Webhook })
+		if h < 0 {
+			d.Status = deliveryFailed
+			d.LastError = "webhook removed"
+			d.UpdatedAt = now
+			continue
+		}
+		if !d.NextAttempt.After(now) {
+			return *d, hooks[h], 0
+		}
+		wait = min(wait, d.NextAttempt.Sub(now))
+	}
+	return delivery{}, webhook{}, wait
+}
+
+// deliver makes one attempt to send d and records the outcome. An
+// attempt aborted by stop does not count, d stays due.
+func (wh *webhooks) deliver(d delivery, h webhook) {
+	code, err := wh.send(d, h)
+	if err != nil && wh.ctx.Err() != nil {
+		return
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	i := slices.IndexFunc(wh.state.Deliveries, func(q delivery) bool { return q.ID == d.ID })
+	if i < 0 {
+		return
+	}
+	q := &wh.state.Deliveries[i]
+	q.Attempts++
+	q.ResponseCode = code
+	q.UpdatedAt = time.Now()
+	switch {
+	case err == nil:
+		q.Status = deliveryDelivered
+		q.LastError = ""
+		q.NextAttempt = time.Time{}
+	case q.Attempts >= wh.opts.maxAttempts:
+		q.Status = deliveryFailed
+		q.LastError = err.Error()
+		q.NextAttempt = time.Time{}
+		wh.logger.Warn("Webhook delivery failed", "webhook", h.ID, "delivery", q.ID,
+			"attempts", q.Attempts, "error", err)
+	default:
+		q.LastError = err.Error()
+		q.NextAttempt = q.UpdatedAt.Add(wh.backoff(q.Attempts))
+		wh.logger.Debug("Webhook delivery will be retried", "webhook", h.ID, "delivery", q.ID,
+			"attempts", q.Attempts, "next_attempt", q.NextAttempt, "error", err)
+	}
+	wh.trim()
+	wh.dirty = true
+}
+
+// backoff doubles the base delay with every failed attempt.
+func (wh *webhooks) backoff(attempts int) time.Duration {
+	d := wh.opts.backoff
+	for i := 1; i < attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, webhookMaxBackoff)
+}
+
+func (wh *webhooks) send(d delivery, h webhook) (int, error) {
+	req, err := http.NewRequestWithContext(wh.ctx, http.MethodPost, h.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, d.Event)
+	req.Header.Set(webhookDeliveryHeader, d.ID)
+	req.Header.Set(webhookSignatureHeader, signPayload(h.Secret, d.Payload))
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return resp.StatusCode, nil
+}
+
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// trim drops the oldest finished deliveries beyond webhookLogSize.
+func (wh *webhooks) trim() {
+	finished := 0
+	for _, d := range wh.state.Deliveries {
+		if d.Status != deliveryPending {
+			finished++
+		}
+	}
+	drop := finished - webhookLogSize
+	if drop <= 0 {
+		return
+	}
+	wh.state.Deliveries = slices.DeleteFunc(wh.state.Deliveries, func(d delivery) bool {
+		if drop > 0 && d.Status != deliveryPending {
+			drop--
+			return true
+		}
+		return false
+	})
+}
+
+// persist writes the queue file when the state changed since the last
+// write, holding wh.mu only to encode the state. A failed write is
+// retried on the next call.
+func (wh *webhooks) persist() {
+	wh.saveMu.Lock()
+	defer wh.saveMu.Unlock()
+
+	wh.mu.Lock()
+	if !wh.dirty || wh.opts.file == "" {
+		wh.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(wh.state)
+	wh.dirty = err != nil
+	wh.mu.Unlock()
+	if err == nil {
+		err = wh.write(data)
+	}
+	if err != nil {
+		wh.logger.Error("Fail to save webhook queue", "error", err)
+		wh.mu.Lock()
+		wh.dirty = true
+		wh.mu.Unlock()
+	}
+}
+
+// save writes the queue file now. The caller holds wh.saveMu and wh.mu.
+func (wh *webhooks) save() error {
+	if wh.opts.file == "" {
+		return nil
+	}
+	data, err := json.Marshal(wh.state)
+	if err != nil {
+		return err
+	}
+	if err := wh.write(data); err != nil {
+		return err
+	}
+	wh.dirty = false
+	return nil
+}
+
+// write replaces the queue file through a temporary file, so a crash
+// never leaves it truncated. The caller holds wh.saveMu.
+func (wh *webhooks) write(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(wh.opts.file), filepath.Base(wh.opts.file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), wh.opts.file)
+}
+
+// adminWebhooksHandler serves the webhook admin API:
+//
+//	GET    /admin/webhooks             list webhooks
+//	POST   /admin/webhooks             register a webhook
+//	DELETE /admin/webhooks/{id}        remove a webhook
+//	GET    /admin/webhooks/deliveries  delivery log, ?webhook= and ?status= filter it
+func adminWebhooksHandler(wh *webhooks) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/webhooks"), "/")
+		switch {
+		case path == "" && r.Method == http.MethodGet:
+			results := []webhookView{}
+			for _, h := range wh.list() {
+				results = append(results, h.view())
+			}
+			replyResults(w, r, results, len(results))
+		case path == "" && r.Method == http.MethodPost:
+			var h webhook
+			if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+				replyErrorContent(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %s", err))
+				return
+			}
+			h, err := wh.add(webhook{URL: h.URL, Secret: h.Secret, Events: h.Events})
+			if err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, ErrInvalidData) {
+					status = http.StatusBadRequest
+				}
+				replyErrorContent(w, r, status, err.Error())
+				return
+			}
+			replyJSON(w, r, http.StatusCreated, h.view())
+		case path == "deliveries" && r.Method == http.MethodGet:
+			q := r.URL.Query()
+			results := wh.deliveries(q.Get("webhook"), q.Get("status"))
+			replyResults(w, r, results, len(results))
+		case path != "" && path != "deliveries" && r.Method == http.MethodDelete:
+			err := wh.remove(path)
+			switch {
+			case err == nil:
+				replyTextContent(w, r, http.StatusNoContent, "")
+			case errors.Is(err, ErrNotFound):
+				replyErrorContent(w, r, http.StatusNotFound, err.Error())
+			case errors.Is(err, ErrConflict):
+				replyErrorContent(w, r, http.StatusConflict, err.Error())
+			default:
+				replyErrorContent(w, r, http.StatusInternalServerError, err.Error())
+			}
+		default:
+			replyErrorContent(w, r, http.StatusMethodNotAllowed, "Method not supported")
+		}
+	}
+}